@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
 
+	"github.com/besten/internal/debugger"
 	"github.com/besten/internal/modules"
 	"github.com/besten/internal/runtime"
 )
@@ -17,6 +21,52 @@ func args() []runtime.Object {
 	return res
 }
 
+//The tracer is flushed and its file closed by the returned function
+func newTracer(path, name, ops string, depth int, asJSON bool) (*runtime.Tracer, func()) {
+	codes := make([]runtime.ICode, 0)
+	for _, op := range strings.Split(ops, ",") {
+		if op = strings.ToUpper(strings.TrimSpace(op)); op == "" {
+			continue
+		}
+		code, ok := runtime.ParseICode(op)
+		if !ok {
+			panic(fmt.Errorf("Unknown instruction %s to trace", op))
+		}
+		codes = append(codes, code)
+	}
+	out := os.Stderr
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			panic(err)
+		}
+		out = f
+	}
+	tracer := runtime.NewTracer(out, depth, name, codes, asJSON)
+	return tracer, func() {
+		if err := tracer.Flush(); err != nil {
+			fmt.Fprintln(os.Stderr, "besten error while tracing:", err)
+		}
+		if out != os.Stderr {
+			out.Close()
+		}
+	}
+}
+
+//The profile is written even if the program failed, it ends once the main process does
+func writeProfile(path string, profiler *runtime.Profiler) {
+	f, err := os.Create(path)
+	if err == nil {
+		err = profiler.Write(f)
+		if e := f.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "besten error while profiling:", err)
+	}
+}
+
 func main() {
 	var step string = "compilation"
 	defer func() {
@@ -24,8 +74,28 @@ func main() {
 			fmt.Printf("besten error during %s: %s\n\t", step, e)
 		}
 	}()
-	var file string
+	//besten run file.bst is the same as besten file.bst, besten debug file.bst stops at the first line
+	command := "run"
+	if len(os.Args) > 1 && (os.Args[1] == "run" || os.Args[1] == "debug") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	debugging := command == "debug"
+	var file, trace, traceName, traceOps, profile string
+	var sched, structured, traceJSON bool
+	var quantum, traceStack int
+	var seed int64
 	flag.StringVar(&file, "file", "", "File to be compiled")
+	flag.BoolVar(&sched, "sched", false, "Run every process in turns on a single thread")
+	flag.IntVar(&quantum, "quantum", 100, "Instructions a process runs before passing the turn")
+	flag.Int64Var(&seed, "seed", 0, "Seed for the order the scheduler picks the processes")
+	flag.BoolVar(&structured, "structured", false, "Wait for the spawned tasks when the call that spawned them returns")
+	flag.StringVar(&trace, "trace", "", "File to write every instruction run, - for the standard error")
+	flag.StringVar(&traceName, "trace-name", "", "Prefix of the compilation name of the symbols traced")
+	flag.StringVar(&traceOps, "trace-ops", "", "Comma separated instructions traced, every one by default")
+	flag.IntVar(&traceStack, "trace-stack", 3, "Items of the function stack written for each instruction")
+	flag.BoolVar(&traceJSON, "trace-json", false, "Write the trace as JSON Lines")
+	flag.StringVar(&profile, "profile", "", "File to write a pprof profile of the instructions run and the time spent by function and line")
 	flag.Parse()
 	if flag.NArg() > 0 {
 		file = flag.Arg(0)
@@ -40,22 +110,36 @@ func main() {
 	step = "execution"
 	vm := runtime.NewVM()
 	vm.LoadSymbols(symbols)
-	/*{
-		f, err := os.Create("cpu.prof")
-		if err != nil {
-			log.Fatal("could not create CPU profile: ", err)
-		}
-		defer f.Close()
-		if err := pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("could not start CPU profile: ", err)
-		}
-		defer pprof.StopCPUProfile()
-	}*/
-	process, err := vm.InitSpawn(cname, []runtime.Object{runtime.MakeVec(args()...)})
+	//While a process is stopped in the debugger it keeps the turn, so the others stay still
+	if sched || debugging {
+		vm.UseScheduler(quantum, seed)
+	}
+	if structured {
+		vm.UseStructured()
+	}
+	if trace != "" {
+		tracer, close := newTracer(trace, traceName, traceOps, traceStack, traceJSON)
+		vm.UseTracer(tracer)
+		defer close()
+	}
+	if profile != "" {
+		profiler := runtime.NewProfiler()
+		vm.UseProfiler(profiler)
+		defer writeProfile(profile, profiler)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if debugging {
+		debugger.Attach(vm, os.Stdin, os.Stdout, stop)
+	}
+	process, err := vm.InitSpawn(ctx, cname, []runtime.Object{runtime.MakeVec(args()...)})
 	if err != nil {
 		panic(err)
 	}
-	err = vm.Wait(process)
+	err = vm.Wait(ctx, process)
+	if debugging && err == context.Canceled {
+		return
+	}
 	if err != nil {
 		panic(err)
 	}
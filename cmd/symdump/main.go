@@ -4,52 +4,27 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
-	"strconv"
 	"strings"
 
 	"github.com/besten/internal/modules"
 	"github.com/besten/internal/runtime"
 )
 
-func itable(path string) map[int]string {
-	b, e := ioutil.ReadFile(path)
-	if e != nil {
-		panic(e)
+func dumpInto(s runtime.Symbol, dest io.Writer) {
+	fmt.Fprintln(dest, "Dumped from: ", s.Name)
+	if s.Info != nil {
+		fmt.Fprintf(dest, "\t%s(%s)\n", s.Info.Function, strings.Join(s.Info.Args, ", "))
 	}
-	result := make(map[int]string)
-	lines := strings.Split(string(b), "\n")
-	flag := false
-	for i := 0; i < len(lines); i++ {
-		if flag {
-			n := strings.Split(lines[i], "/")
-			if len(n) > 0 {
-				target := strings.TrimSpace(n[0])
-				if target == ")" {
-					break
-				}
-				if len(target) > 0 && target[0] != '/' {
-					parts := strings.Split(target, "=")
-					ids := strings.Split(parts[0], " ")
-					icode, e := strconv.Atoi(strings.TrimSpace(parts[1]))
-					if e != nil {
-						panic(e)
-					}
-					result[icode] = ids[0]
-				}
+	last := ""
+	for i, v := range s.Source {
+		if file, line, column, ok := s.Lines.Lookup(i); ok {
+			if at := fmt.Sprintf("%s:%d:%d", file, line, column); at != last {
+				fmt.Fprintf(dest, "\t     ; %s\n", at)
+				last = at
 			}
-		} else if strings.TrimSpace(lines[i]) == "const (" {
-			flag = true
 		}
-	}
-	return result
-}
-
-func dumpInto(s runtime.Symbol, table map[int]string, dest io.Writer) {
-	fmt.Fprintln(dest, "Dumped from: ", s.Name)
-	for i, v := range s.Source {
-		fmt.Fprintf(dest, "\t%4d %s", i, table[int(v.Code)])
+		fmt.Fprintf(dest, "\t%4d %s", i, v.Code)
 		for _, v := range v.Inspect() {
 			fmt.Fprint(dest, " ", v)
 		}
@@ -63,7 +38,6 @@ func main() {
 			fmt.Println("Error while dumping: \n\t", e)
 		}
 	}()
-	table := itable("./internal/runtime/instructionset.go")
 	var name string
 	flag.StringVar(&name, "name", "", "Prefix to compare the symbol compilation name")
 	flag.Parse()
@@ -77,7 +51,7 @@ func main() {
 	}
 	for k, s := range symbols {
 		if strings.HasPrefix(k, name) {
-			dumpInto(s, table, os.Stdout)
+			dumpInto(s, os.Stdout)
 		}
 	}
 	fmt.Println("Dumping done!")
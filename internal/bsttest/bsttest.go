@@ -0,0 +1,131 @@
+//Helpers for the tests, they compile and run besten programs written inline
+package bsttest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/besten/internal/modules"
+	"github.com/besten/internal/runtime"
+)
+
+//Root of the repository, where the std folder is
+func root() string {
+	_, file, _, _ := goruntime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..")
+}
+
+//Writes the source as main.bst inside a folder next to a link to std, so it is imported with import "../std"
+func Write(t *testing.T, src string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.Symlink(filepath.Join(root(), "std"), filepath.Join(dir, "std")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "prog"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "prog", "main.bst")
+	if err := ioutil.WriteFile(file, []byte(Source(src)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+//Source with the lines of src unindented as much as the first one, so it can be written inside the test
+func Source(src string) string {
+	lines := strings.Split(strings.TrimLeft(strings.TrimRight(src, "\t \n"), "\n"), "\n")
+	indent := len(lines[0]) - len(strings.TrimLeft(lines[0], "\t "))
+	for i, l := range lines {
+		if len(l) >= indent {
+			lines[i] = l[indent:]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//Writes another source file in the folder of the program, so it can import it
+func WriteNext(t *testing.T, file, name, src string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(filepath.Dir(file), name), []byte(Source(src)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+//Compiles the program, the error is the one of the compilation
+func Compile(t *testing.T, src string) (map[string]runtime.Symbol, string, error) {
+	t.Helper()
+	return modules.New().MainFile(Write(t, src))
+}
+
+//Every output of the programs goes through the standard output, so they run one at a time
+var outputLock sync.Mutex
+
+//Compiles and runs the program, returns what it printed and the error of the main process.
+//Setup is called with the machine before spawning, in order to use the scheduler or the hooks
+func Run(t *testing.T, src string, setup func(vm *runtime.VM)) (string, error) {
+	t.Helper()
+	return RunFile(t, Write(t, src), setup)
+}
+
+//Same as Run for a program already written
+func RunFile(t *testing.T, file string, setup func(vm *runtime.VM)) (string, error) {
+	t.Helper()
+	symbols, cname, err := modules.New().MainFile(file)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+	vm := runtime.NewVM()
+	vm.LoadSymbols(symbols)
+	if setup != nil {
+		setup(vm)
+	}
+	var out string
+	err = Capture(func() error {
+		process, err := vm.InitSpawn(context.Background(), cname, []runtime.Object{runtime.MakeVec()})
+		if err != nil {
+			return err
+		}
+		return vm.Wait(context.Background(), process)
+	}, &out)
+	return out, err
+}
+
+//Runs f with the standard output redirected into out
+func Capture(f func() error, out *string) error {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	read := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		read <- b.String()
+	}()
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	*out = <-read
+	r.Close()
+	return err
+}
+
+//Uses the scheduler with the given quantum and seed
+func Scheduled(quantum int, seed int64) func(vm *runtime.VM) {
+	return func(vm *runtime.VM) {
+		vm.UseScheduler(quantum, seed)
+	}
+}
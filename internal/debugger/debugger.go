@@ -0,0 +1,309 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/besten/internal/runtime"
+)
+
+type stepMode int
+
+const (
+	running  stepMode = iota
+	stepInto          //Until the line changes
+	stepOver          //Until the line changes without entering calls
+	stepOut           //Until the current function returns
+	detached          //Never stops again
+)
+
+type location struct {
+	file string
+	line int
+}
+
+//Stops the processes of a machine at breakpoints and steps, reading the commands from the input.
+//The machine must run the processes in turns, so the stopped one keeps the others still
+type Debugger struct {
+	vm        *runtime.VM
+	in        *bufio.Scanner
+	out       io.Writer
+	quit      func()
+	lock      sync.Mutex
+	lines     map[location]bool
+	functions map[string]bool
+	mode      stepMode
+	stepProc  *runtime.Process //Process being stepped, nil for any
+	stepDepth int
+	stepAt    location
+	last      map[*runtime.Process]location
+	selected  *runtime.Process
+	frame     int
+	sources   map[string][]string
+}
+
+//Attaches the debugger to the machine, it stops at the first line run. Quitting calls quit
+func Attach(vm *runtime.VM, in io.Reader, out io.Writer, quit func()) *Debugger {
+	d := &Debugger{vm, bufio.NewScanner(in), out, quit, sync.Mutex{},
+		make(map[location]bool), make(map[string]bool), stepInto, nil, 0, location{},
+		make(map[*runtime.Process]location), nil, 0, make(map[string][]string)}
+	vm.AddHook(d.hook)
+	return d
+}
+
+func (d *Debugger) hook(proc *runtime.Process) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.mode == detached {
+		return
+	}
+	at := proc.Location()
+	if at.File == "" {
+		return
+	}
+	here := location{at.File, at.Line}
+	previous, seen := d.last[proc]
+	d.last[proc] = here
+	entered := !seen || previous != here
+	reason := ""
+	switch {
+	case at.PC == 0 && d.functions[at.Function]:
+		reason = "breakpoint at " + at.Function
+	case entered && d.breakpointAt(here):
+		reason = fmt.Sprintf("breakpoint at %s:%d", shortName(here.file), here.line)
+	case d.stepProc != nil && d.stepProc != proc:
+	case d.mode == stepInto && (here != d.stepAt || proc.Depth() != d.stepDepth):
+		reason = "step"
+	case d.mode == stepOver && (proc.Depth() < d.stepDepth || proc.Depth() == d.stepDepth && here != d.stepAt):
+		reason = "step"
+	case d.mode == stepOut && proc.Depth() < d.stepDepth:
+		reason = "step"
+	}
+	if reason != "" {
+		d.stop(proc, reason)
+	}
+}
+
+func (d *Debugger) breakpointAt(here location) bool {
+	for l := range d.lines {
+		if l.line == here.line && (l.file == here.file || strings.HasSuffix(here.file, "/"+l.file)) {
+			return true
+		}
+	}
+	return false
+}
+
+//Reads commands until one of them resumes the execution
+func (d *Debugger) stop(proc *runtime.Process, reason string) {
+	d.selected, d.frame = proc, 0
+	fmt.Fprintf(d.out, "Process %d stopped, %s\n", proc.ID(), reason)
+	d.show(proc.Location())
+	for {
+		fmt.Fprint(d.out, "(debug) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.mode = detached
+			return
+		}
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if d.command(fields[0], fields[1:]) {
+			return
+		}
+	}
+}
+
+//Runs the command, true if the execution must go on
+func (d *Debugger) command(name string, args []string) bool {
+	switch name {
+	case "c", "continue":
+		d.resume(running)
+		return true
+	case "s", "step":
+		d.resume(stepInto)
+		return true
+	case "n", "next":
+		d.resume(stepOver)
+		return true
+	case "o", "out":
+		d.resume(stepOut)
+		return true
+	case "q", "quit":
+		d.mode = detached
+		d.quit()
+		return true
+	case "b", "break":
+		if len(args) == 0 {
+			d.listBreakpoints()
+		} else {
+			d.setBreakpoint(args[0], true)
+		}
+	case "d", "delete":
+		if len(args) == 0 {
+			fmt.Fprintln(d.out, "Expecting a breakpoint to delete")
+		} else {
+			d.setBreakpoint(args[0], false)
+		}
+	case "bt", "backtrace":
+		for i, f := range d.selected.Trace() {
+			mark := " "
+			if i == d.frame {
+				mark = ">"
+			}
+			fmt.Fprintf(d.out, "%s #%d %s\n", mark, i, f)
+		}
+	case "f", "frame":
+		if len(args) == 0 {
+			fmt.Fprintf(d.out, "Frame %d\n", d.frame)
+			break
+		}
+		n, err := strconv.Atoi(args[0])
+		if frames := d.selected.Trace(); err != nil || n < 0 || n >= len(frames) {
+			fmt.Fprintf(d.out, "No frame %s\n", args[0])
+		} else {
+			d.frame = n
+			d.show(frames[n])
+		}
+	case "a", "args", "l", "locals":
+		vars, locals := d.selected.Variables(d.frame)
+		if name == "l" || name == "locals" {
+			vars = locals
+		}
+		if len(vars) == 0 {
+			fmt.Fprintln(d.out, "None")
+		}
+		for _, v := range vars {
+			fmt.Fprintf(d.out, "%s = %s\n", v.Name, runtime.Describe(v.Value))
+		}
+	case "st", "stack":
+		items := d.selected.Stack()
+		if len(items) == 0 {
+			fmt.Fprintln(d.out, "Empty")
+		}
+		for i, o := range items {
+			fmt.Fprintf(d.out, "%d: %s\n", i, runtime.Describe(o))
+		}
+	case "ps", "procs":
+		for _, p := range d.vm.Processes() {
+			mark := " "
+			if p == d.selected {
+				mark = ">"
+			}
+			fmt.Fprintf(d.out, "%s %d %s\n", mark, p.ID(), p.Location())
+		}
+	case "p", "proc":
+		if len(args) == 0 {
+			fmt.Fprintf(d.out, "Process %d\n", d.selected.ID())
+			break
+		}
+		if p := d.process(args[0]); p == nil {
+			fmt.Fprintf(d.out, "No process %s\n", args[0])
+		} else {
+			d.selected, d.frame = p, 0
+			d.show(p.Location())
+		}
+	case "h", "help":
+		fmt.Fprint(d.out, help)
+	default:
+		fmt.Fprintf(d.out, "Unknown command %s, try help\n", name)
+	}
+	return false
+}
+
+const help = `c, continue         run until a breakpoint
+s, step             run until the line changes, entering calls
+n, next             run until the line changes in the same function
+o, out              run until the function returns
+b, break [file:line|function]  set a breakpoint or list them
+d, delete file:line|function   remove a breakpoint
+bt, backtrace       functions being run by the process
+f, frame [n]        select the nth function of the backtrace
+a, args             arguments of the selected function
+l, locals           local variables of the selected function
+st, stack           items of the function stack, the top first
+ps, procs           running processes
+p, proc [id]        select a process, stepping applies to it
+q, quit             cancel the program
+`
+
+//Steps are relative to the selected process, as it is where the user is looking at
+func (d *Debugger) resume(mode stepMode) {
+	d.mode, d.stepProc = mode, nil
+	if mode != running {
+		at := d.selected.Location()
+		d.stepProc, d.stepDepth, d.stepAt = d.selected, d.selected.Depth(), location{at.File, at.Line}
+	}
+}
+
+func (d *Debugger) setBreakpoint(target string, set bool) {
+	if i := strings.LastIndex(target, ":"); i > 0 {
+		line, err := strconv.Atoi(target[i+1:])
+		if err != nil {
+			fmt.Fprintf(d.out, "Invalid line %s\n", target[i+1:])
+			return
+		}
+		if set {
+			d.lines[location{target[:i], line}] = true
+		} else {
+			delete(d.lines, location{target[:i], line})
+		}
+	} else if set {
+		d.functions[target] = true
+	} else {
+		delete(d.functions, target)
+	}
+}
+
+func (d *Debugger) listBreakpoints() {
+	if len(d.lines)+len(d.functions) == 0 {
+		fmt.Fprintln(d.out, "No breakpoints")
+	}
+	for l := range d.lines {
+		fmt.Fprintf(d.out, "%s:%d\n", l.file, l.line)
+	}
+	for f := range d.functions {
+		fmt.Fprintln(d.out, f)
+	}
+}
+
+func (d *Debugger) process(id string) *runtime.Process {
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return nil
+	}
+	for _, p := range d.vm.Processes() {
+		if p.ID() == n {
+			return p
+		}
+	}
+	return nil
+}
+
+//Prints the frame along with its line of source, if the file can be read
+func (d *Debugger) show(f runtime.Frame) {
+	fmt.Fprintln(d.out, f)
+	lines, ok := d.sources[f.File]
+	if !ok && f.File != "" {
+		if b, err := ioutil.ReadFile(f.File); err == nil {
+			lines = strings.Split(string(b), "\n")
+		}
+		d.sources[f.File] = lines
+	}
+	if f.Line > 0 && f.Line <= len(lines) {
+		fmt.Fprintf(d.out, "%5d | %s\n", f.Line, strings.TrimRight(lines[f.Line-1], "\r"))
+	}
+}
+
+func shortName(file string) string {
+	if i := strings.LastIndex(file, "/"); i >= 0 {
+		return file[i+1:]
+	}
+	return file
+}
@@ -0,0 +1,76 @@
+package debugger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/debugger"
+	"github.com/besten/internal/runtime"
+)
+
+func TestDebugger(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn square: n Int do
+		    val r = n * n
+		    return r
+
+		fn main: args Vec|Str do
+		    val a = 3
+		    print: square(a)
+	`
+	commands := "b square\nc\na\nbt\nn\nl\nc\n"
+	var log bytes.Buffer
+	out, err := bsttest.Run(t, src, func(vm *runtime.VM) {
+		vm.UseScheduler(1, 0)
+		debugger.Attach(vm, strings.NewReader(commands), &log, func() {})
+	})
+	if err != nil || out != "9\n" {
+		t.Fatalf("Got %q, %v", out, err)
+	}
+	//Each one must be found after the previous one
+	expected := []string{
+		"Process 1 stopped, step", "8 |     val a = 3",
+		"Process 1 stopped, breakpoint at square", "4 |     val r = n * n",
+		"n = 3",
+		"> #0 square(Int) at ", "  #1 main(Vec|Str) at ",
+		"Process 1 stopped, step", "5 |     return r",
+		"r = 9",
+	}
+	rest := log.String()
+	for _, e := range expected {
+		i := strings.Index(rest, e)
+		if i < 0 {
+			t.Fatalf("Expecting %q in the output of the debugger:\n%s", e, log.String())
+		}
+		rest = rest[i+len(e):]
+	}
+}
+
+func TestDebuggerQuit(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn main: args Vec|Str do
+		    print: 1
+		    print: 2
+	`
+	var log bytes.Buffer
+	quitted := false
+	out, _ := bsttest.Run(t, src, func(vm *runtime.VM) {
+		vm.UseScheduler(1, 0)
+		debugger.Attach(vm, strings.NewReader("n\nq\n"), &log, func() {
+			quitted = true
+		})
+	})
+	if !quitted {
+		t.Fatalf("Expecting to quit:\n%s", log.String())
+	}
+	//Once quitted the debugger must not stop the program again
+	if out != "1\n2\n" || strings.Count(log.String(), "stopped") != 2 {
+		t.Fatalf("Got %q\n%s", out, log.String())
+	}
+}
@@ -9,7 +9,8 @@ import (
 
 type dirtyBlock struct {
 	line     int
-	raw      string
+	column   int    //Column where the raw content starts
+	raw      string //Line content without indentation
 	children []dirtyBlock
 	parent   *dirtyBlock
 }
@@ -36,12 +37,13 @@ func indentSolver(arr []string, indent string) (remain string, relative int, err
 	return
 }
 
-func getRawStructure(src io.Reader) (blocks []dirtyBlock, linenum int, err error) {
+//lines: Every non empty line of the source, stores the raw text in order to report errors
+func getRawStructure(src io.Reader, lines map[int]string) (blocks []dirtyBlock, linenum int, err error) {
 	reader := bufio.NewReader(src)
 	line := ""
 	var indent_array []string
 
-	active := &dirtyBlock{-1, "", blocks, nil}
+	active := &dirtyBlock{-1, 0, "", blocks, nil}
 	root := active
 
 	for {
@@ -66,6 +68,7 @@ func getRawStructure(src io.Reader) (blocks []dirtyBlock, linenum int, err error
 		noindent := strings.TrimLeft(line, separators)
 		indentsize := len(line) - len(noindent)
 		sub_indent, relative, e := indentSolver(indent_array, line[:indentsize])
+		lines[linenum] = line
 		line = ""
 		if e != nil {
 			err = e
@@ -95,7 +98,7 @@ func getRawStructure(src io.Reader) (blocks []dirtyBlock, linenum int, err error
 			}
 			active = &active.children[len(active.children)-1]
 		}
-		active.children = append(active.children, dirtyBlock{linenum, noindent, make([]dirtyBlock, 0), active})
+		active.children = append(active.children, dirtyBlock{linenum, indentsize + 1, noindent, make([]dirtyBlock, 0), active})
 	}
 	blocks = root.children
 	return
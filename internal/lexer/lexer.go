@@ -15,10 +15,11 @@ type Source interface {
 
 type Lexer struct {
 	source Source
+	lines  map[int]string //Source text indexed by line number
 }
 
 func LexerFor(source Source) *Lexer {
-	return &Lexer{source: source}
+	return &Lexer{source: source, lines: make(map[int]string)}
 }
 
 type Block struct {
@@ -28,13 +29,41 @@ type Block struct {
 	Children []Block
 	Parent   *Block
 	Origin   string
+	Lines    map[int]string //Source text of the lines that compose the block
 }
 
-func getChilds(blks []dirtyBlock) (line []Token, sub bool, children []dirtyBlock, lline int, err error) {
+//Error produced at a known source position
+type SourceError struct {
+	Pos Position
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+//Attaches the position to the error unless it is already located
+func ErrorAt(pos Position, err error) error {
+	var located *SourceError
+	if err == nil || !pos.Known() || errors.As(err, &located) {
+		return err
+	}
+	return &SourceError{pos, err}
+}
+
+func (l *Lexer) positionOf(raw dirtyBlock) Position {
+	return Position{l.source.Origin(), raw.line, raw.column}
+}
+
+func (l *Lexer) getChilds(blks []dirtyBlock) (line []Token, sub bool, children []dirtyBlock, lline int, err error) {
 	sub = false
 	for i := range blks {
 		//Read and append the token to the main line
-		tk, s, e := GetTokens(blks[i].raw)
+		tk, s, e := GetTokens(blks[i].raw, l.positionOf(blks[i]))
 		lline = blks[i].line
 		if e != nil {
 			err = e
@@ -64,7 +93,7 @@ func getChilds(blks []dirtyBlock) (line []Token, sub bool, children []dirtyBlock
 
 func (l *Lexer) solveBlock(raw dirtyBlock, parent *Block) (block Block, linenum int, err error) {
 	//sublevel: Indicates that any subline is in a sublevel, otherwise sublines would be treat like the same line
-	tks, sublevel, err := GetTokens(raw.raw)
+	tks, sublevel, err := GetTokens(raw.raw, l.positionOf(raw))
 	begin := raw.line
 	linenum = begin
 	end := raw.line
@@ -75,7 +104,7 @@ func (l *Lexer) solveBlock(raw dirtyBlock, parent *Block) (block Block, linenum
 	//Multiline and pick children
 	target_children := raw.children
 	if !sublevel && len(raw.children) > 0 {
-		l, sub, target, nline, e := getChilds(target_children)
+		line, sub, target, nline, e := l.getChilds(target_children)
 		if nline > end {
 			linenum = nline
 			end = nline
@@ -86,7 +115,7 @@ func (l *Lexer) solveBlock(raw dirtyBlock, parent *Block) (block Block, linenum
 		}
 		target_children = target
 		sublevel = sub
-		tks = append(tks, l...)
+		tks = append(tks, line...)
 	}
 	if sublevel != (len(target_children) > 0) {
 		err = errors.New("No correspondence between indentation and block opening")
@@ -106,6 +135,7 @@ func (l *Lexer) solveBlock(raw dirtyBlock, parent *Block) (block Block, linenum
 	block.Tokens = tks
 	block.Children = childs
 	block.Origin = l.source.Origin()
+	block.Lines = l.lines
 	return
 }
 
@@ -134,11 +164,15 @@ func (l *Lexer) GetBlocks() (blocks []Block, err error) {
 					file = relpath
 				}
 			}
-			line := ""
-			if target_line >= 0 {
+			line, excerpt := "", ""
+			var located *SourceError
+			if errors.As(err, &located) {
+				line = fmt.Sprintf(" [Error in line (%d:%d)]", located.Pos.Line, located.Pos.Column)
+				excerpt = located.Pos.Excerpt(l.lines)
+			} else if target_line >= 0 {
 				line = fmt.Sprintf(" [Error in line (%d)]", target_line)
 			}
-			err = fmt.Errorf("[File: %s]%s\n\t%s", file, line, err.Error())
+			err = fmt.Errorf("[File: %s]%s\n\t%s%s", file, line, err.Error(), excerpt)
 		}
 	}()
 	var s io.ReadCloser
@@ -146,7 +180,7 @@ func (l *Lexer) GetBlocks() (blocks []Block, err error) {
 		return
 	}
 	var raw_blocks []dirtyBlock
-	raw_blocks, target_line, err = getRawStructure(s)
+	raw_blocks, target_line, err = getRawStructure(s, l.lines)
 	if err != nil {
 		return
 	}
@@ -43,18 +43,61 @@ func (ttype TokenType) Representation() string {
 	}
 }
 
+//Location of a token inside its source, lines and columns start at 1
+type Position struct {
+	Origin string
+	Line   int
+	Column int
+}
+
+func (pos Position) Known() bool {
+	return pos.Line > 0
+}
+
+func (pos Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", pos.Origin, pos.Line, pos.Column)
+}
+
+//Source line followed by a caret under the column, empty if the line is unknown
+func (pos Position) Excerpt(lines map[int]string) string {
+	text, e := lines[pos.Line]
+	if !e || pos.Column < 1 {
+		return ""
+	}
+	pad := make([]rune, 0)
+	for i, r := range []rune(text) {
+		if i >= pos.Column-1 {
+			break
+		}
+		if r == '\t' {
+			pad = append(pad, r)
+		} else {
+			pad = append(pad, ' ')
+		}
+	}
+	return fmt.Sprintf("\n\t%s\n\t%s^", text, string(pad))
+}
+
 type Token struct {
 	Data string
 	Kind TokenType
+	Pos  Position
+}
+
+//Compares the token content, ignoring where it was found
+func (t Token) Is(other Token) bool {
+	return t.Data == other.Data && t.Kind == other.Kind
 }
 
 var string_mark rune = '"'
 var decimal_mark rune = '.'
 var underscore_mark rune = '_'
+var question_mark rune = '?' //Only as the end of an identifier: done?
 var specials []string = []string{",", ".", "(", ")", ":", "[", "]", "{", "}"}
 var keywords []string = []string{"import", "struct", "return", "fn", "op", "do",
-	"val", "var", "if", "else", "for", "in", "while", "throw", "rescue", "spawn",
-	"true", "false", "direct", "ref", "break", "continue", "omit", "drop", "alias"}
+	"val", "var", "if", "else", "for", "in", "while", "throw", "rescue", "ensure", "spawn",
+	"true", "false", "direct", "ref", "break", "continue", "omit", "drop", "alias", "match", "enum",
+	"interface", "none", "select"}
 
 func strArrContains(arr []string, elem string) bool {
 	for _, a := range arr {
@@ -77,16 +120,16 @@ func leter(char rune) bool {
 	return char >= 48 && char <= 57
 }
 
-func solveToken(mask TokenType, value string) (Token, error) {
+func solveToken(mask TokenType, value string, pos Position) (Token, error) {
 	if mask == OperatorToken && strArrContains(specials, value) {
-		return Token{value, SpecialToken}, nil
+		return Token{Data: value, Kind: SpecialToken, Pos: pos}, nil
 	} else if mask == IntegerToken || mask == DecimalToken || mask == OperatorToken || mask == StringToken {
-		return Token{value, mask}, nil
+		return Token{Data: value, Kind: mask, Pos: pos}, nil
 	} else if mask == IdToken {
 		if strArrContains(keywords, value) {
 			mask = KeywordToken
 		}
-		return Token{value, mask}, nil
+		return Token{Data: value, Kind: mask, Pos: pos}, nil
 	} else if mask == NoneToken {
 		return Token{}, errors.New("Trying to solve none type")
 	}
@@ -116,6 +159,8 @@ func updateMask(previous []rune, mask TokenType, char rune) (newmask TokenType,
 		} else if char == string_mark {
 			newmask = StringToken
 			action = pushNoAdd
+		} else if char == question_mark && mask == IdToken {
+			action = mergeTokens
 		} else if char == underscore_mark {
 			if mask == IdToken {
 				action = mergeTokens
@@ -188,16 +233,27 @@ func string_analysis(last rune, char rune) (bool, []rune, error) {
 	return false, []rune{char}, nil
 }
 
-func tokens(line string) (tokens []Token, err error) {
+//pos: Position of the first character of the line
+func tokens(line string, pos Position) (tokens []Token, err error) {
 	mask := NoneToken
 	value := make([]rune, 0)
 	characters := []rune(line)
+	begin := 0 //Column offset where the current value starts
+	at := func(offset int) Position {
+		return Position{pos.Origin, pos.Line, pos.Column + offset}
+	}
+	defer func() {
+		if err != nil {
+			err = ErrorAt(at(begin), err)
+		}
+	}()
 
 	for i, r := range characters {
 		//String lock
 		if mask == StringToken {
 			end, push, e := string_analysis(characters[i-1], r)
 			if e != nil {
+				begin = i
 				err = e
 				return
 			}
@@ -205,7 +261,7 @@ func tokens(line string) (tokens []Token, err error) {
 				value = append(value, push...)
 			}
 			if end {
-				t, e := solveToken(mask, string(value))
+				t, e := solveToken(mask, string(value), at(begin))
 				if e != nil {
 					err = e
 					return
@@ -223,14 +279,18 @@ func tokens(line string) (tokens []Token, err error) {
 		if !sep && r != '#' {
 			m, o, e := updateMask(value, mask, r)
 			if e != nil {
+				begin = i
 				err = e
 				return
 			}
 			if o == mergeTokens {
+				if len(value) == 0 {
+					begin = i
+				}
 				value = append(value, r)
 			} else {
 				if len(value) > 0 {
-					t, e := solveToken(mask, string(value))
+					t, e := solveToken(mask, string(value), at(begin))
 					if e != nil {
 						err = e
 						return
@@ -242,13 +302,14 @@ func tokens(line string) (tokens []Token, err error) {
 				} else {
 					value = make([]rune, 0)
 				}
+				begin = i
 			}
 			mask = m
 		}
 
 		//Solves and inserts the token
 		if (i == len(characters)-1 || sep || r == '#') && len(value) > 0 {
-			t, e := solveToken(mask, string(value))
+			t, e := solveToken(mask, string(value), at(begin))
 			if e != nil {
 				err = e
 				return
@@ -274,9 +335,10 @@ func tokens(line string) (tokens []Token, err error) {
 }
 
 //make_sublevel: Indicates that is creating a new scope
-func GetTokens(line string) (result []Token, make_sublevel bool, err error) {
-	result, err = tokens(line)
-	do := Token{"do", KeywordToken}
-	make_sublevel = len(result) > 0 && result[len(result)-1] == do
+//pos: Position of the first character of the line
+func GetTokens(line string, pos Position) (result []Token, make_sublevel bool, err error) {
+	result, err = tokens(line, pos)
+	do := Token{Data: "do", Kind: KeywordToken}
+	make_sublevel = len(result) > 0 && result[len(result)-1].Is(do)
 	return
 }
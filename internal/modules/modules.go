@@ -51,11 +51,12 @@ type Modules struct {
 	modulemx sync.Mutex
 	symbols  map[string]*Symbol
 	symbolmx sync.Mutex
+	pending  sync.WaitGroup //Files of folder modules parsed in the background
 }
 
 func New() *Modules {
 	return &Modules{make([]*storedModule, 0), make(map[string]int),
-		sync.Mutex{}, make(map[string]*Symbol), sync.Mutex{}}
+		sync.Mutex{}, make(map[string]*Symbol), sync.Mutex{}, sync.WaitGroup{}}
 }
 
 func (m *Modules) NewId() int {
@@ -103,14 +104,14 @@ func (m *Modules) LoadModule(requester int, path string) (parser.Module, error)
 		return nil, errors.New("Expecting mod.bst file for folder module")
 	}
 	var files []fs.FileInfo
-	if files, err = ioutil.ReadDir(path); err != nil {
+	if files, err = ioutil.ReadDir(abspath); err != nil {
 		return nil, err
 	}
 	for _, file := range files {
 		if file.IsDir() {
-			go m.LoadModule(requester, filepath.Join(path, file.Name()))
+			m.background(func(path string) { m.LoadModule(requester, path) }, filepath.Join(path, file.Name()))
 		} else if file.Name() != "mod.bst" {
-			go m.FileParser(requester, filepath.Join(path, file.Name()))
+			m.background(func(path string) { m.FileParser(requester, path) }, filepath.Join(abspath, file.Name()))
 		}
 	}
 	p, e := m.FileParser(requester, filepath.Join(abspath, "mod.bst"))
@@ -120,6 +121,14 @@ func (m *Modules) LoadModule(requester int, path string) (parser.Module, error)
 	return p.GetModule(), nil
 }
 
+func (m *Modules) background(load func(string), path string) {
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		load(path)
+	}()
+}
+
 func (m *Modules) checkModuleExistence(requester int, path string, md **storedModule) bool {
 	m.modulemx.Lock()
 	defer m.modulemx.Unlock()
@@ -203,6 +212,7 @@ func (m *Modules) MainFile(name string) (symbols map[string]Symbol, cname string
 	if err != nil {
 		return
 	}
+	m.pending.Wait()
 	symbols = m.collectSymbols()
 	return
 }
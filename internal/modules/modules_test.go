@@ -0,0 +1,74 @@
+package modules_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/besten/internal/modules"
+)
+
+//Program importing a folder module, whose files are parsed in the background
+func writeFolderModule(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lib/mod.bst":        "import \"shared.bst\"\n\nfn twice: n Int do\n    return double(n)\n",
+		"lib/shared.bst":     "fn double: n Int do\n    return n * 2\n",
+		"lib/unused.bst":     "fn unused_helper: n Int do\n    return n\n",
+		"lib/nested/mod.bst": "fn nested_helper: n Int do\n    return n\n",
+		"prog/main.bst":      "import \"../lib\"\n\nfn main: args Vec|Str do\n    twice: 2\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "prog", "main.bst")
+}
+
+//The files of the folder are found from its path, not from the working directory
+func TestFolderModule(t *testing.T) {
+	main := writeFolderModule(t)
+	symbols, _, err := modules.New().MainFile(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []string{"twice/", "double/", "unused_helper/", "nested_helper/"} {
+		found := false
+		for name := range symbols {
+			found = found || strings.HasPrefix(name, fn)
+		}
+		if !found {
+			t.Fatalf("Expecting a symbol for %s", fn)
+		}
+	}
+}
+
+//Run with -race, the modules are parsed at the same time and share the counters of the names
+func TestConcurrentLoading(t *testing.T) {
+	main := writeFolderModule(t)
+	var group sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			_, _, err := modules.New().MainFile(main)
+			errs <- err
+		}()
+	}
+	group.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
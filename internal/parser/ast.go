@@ -18,6 +18,7 @@ type syntaxLiteral struct {
 	value string
 	kind  TokenType
 	owner *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxLiteral) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -49,6 +50,9 @@ func (s *syntaxLiteral) runIntoStack(p *Parser, stack *[]Instruction) (OBJType,
 		} else if s.value == FALSE.Data {
 			ins = MKInstruction(PSH, 0)
 			break
+		} else if s.value == NONE.Data {
+			*stack = append(*stack, MKInstruction(PSH, Null{}))
+			return OptOf(Any), nil
 		}
 		fallthrough
 	default:
@@ -60,7 +64,7 @@ func (s *syntaxLiteral) runIntoStack(p *Parser, stack *[]Instruction) (OBJType,
 
 func isLiteral(tk Token) bool {
 	kind := tk.Kind
-	return kind == StringToken || kind == IntegerToken || kind == DecimalToken || tk == TRUE || tk == FALSE
+	return kind == StringToken || kind == IntegerToken || kind == DecimalToken || tk.Is(TRUE) || tk.Is(FALSE) || tk.Is(NONE)
 }
 
 func getRoute(tk []Token) ([]string, error) {
@@ -70,10 +74,10 @@ func getRoute(tk []Token) ([]string, error) {
 	res := make([]string, 0)
 	for i := 0; i < len(tk); i += 2 {
 		if tk[i].Kind != IdToken {
-			return nil, fmt.Errorf("Unexpected token: %s", tk[i].Data)
+			return nil, ErrorAt(tk[i].Pos, fmt.Errorf("Unexpected token: %s", tk[i].Data))
 		}
-		if i+1 < len(tk) && tk[i+1] != DOT {
-			return nil, fmt.Errorf("Unexpected token: %s", tk[i+1].Data)
+		if i+1 < len(tk) && !tk[i+1].Is(DOT) {
+			return nil, ErrorAt(tk[i+1].Pos, fmt.Errorf("Unexpected token: %s", tk[i+1].Data))
 		}
 		res = append(res, tk[i].Data)
 	}
@@ -83,6 +87,7 @@ func getRoute(tk []Token) ([]string, error) {
 type syntaxAtom struct {
 	value string
 	owner *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxAtom) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -93,12 +98,13 @@ func (s *syntaxAtom) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, err
 type syntaxTupleDefinition struct {
 	elements []syntaxBranch
 	owner    *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxTupleDefinition) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
 	tps := make([]OBJType, len(s.elements))
 	for i := range s.elements {
-		t, e := s.elements[len(s.elements)-i-1].runIntoStack(p, stack)
+		t, e := runBranch(s.elements[len(s.elements)-i-1], p, stack)
 		if e != nil {
 			return nil, e
 		}
@@ -112,11 +118,12 @@ type syntaxConstantAccess struct {
 	target syntaxBranch
 	idx    int
 	owner  *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxConstantAccess) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
 	tempstack := make([]Instruction, 0) //Important to insert the push index
-	r, e := s.target.runIntoStack(p, &tempstack)
+	r, e := runBranch(s.target, p, &tempstack)
 	if e != nil {
 		return nil, e
 	}
@@ -135,12 +142,12 @@ func (s *syntaxConstantAccess) runIntoStack(p *Parser, stack *[]Instruction) (OB
 
 func (s *syntaxConstantAccess) runIntoStackSet(p *Parser, stack *[]Instruction, branch syntaxBranch) error {
 	tempstack := make([]Instruction, 0) //Important to insert the push index
-	r, e := s.target.runIntoStack(p, &tempstack)
+	r, e := runBranch(s.target, p, &tempstack)
 	if e != nil {
 		return e
 	}
 	tempstackval := make([]Instruction, 0) //Important to insert the push index
-	r2, e := branch.runIntoStack(p, &tempstackval)
+	r2, e := runBranch(branch, p, &tempstackval)
 	if e != nil {
 		return e
 	}
@@ -166,6 +173,7 @@ type syntaxRoute struct {
 	origin syntaxBranch //if origin is not null is where the route access to
 	route  []string     //Maybe include de single variable case, already implemented in syntaxLiteral
 	owner  *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxRoute) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -176,7 +184,7 @@ func (s *syntaxRoute) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, er
 	var err error
 	route := s.route
 	if s.origin != nil {
-		tp, err = s.origin.runIntoStack(p, stack)
+		tp, err = runBranch(s.origin, p, stack)
 		if err != nil {
 			return nil, err
 		}
@@ -201,7 +209,7 @@ func (s *syntaxRoute) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, er
 }
 
 func (s *syntaxRoute) runIntoStackSet(p *Parser, stack *[]Instruction, branch syntaxBranch) error {
-	objtype, err := branch.runIntoStack(p, stack)
+	objtype, err := runBranch(branch, p, stack)
 	if err != nil {
 		return err
 	}
@@ -211,7 +219,7 @@ func (s *syntaxRoute) runIntoStackSet(p *Parser, stack *[]Instruction, branch sy
 	var tp OBJType
 	route := s.route
 	if s.origin != nil {
-		tp, err = s.origin.runIntoStack(p, stack)
+		tp, err = runBranch(s.origin, p, stack)
 		if err != nil {
 			return err
 		}
@@ -248,29 +256,31 @@ func (s *syntaxRoute) runIntoStackSet(p *Parser, stack *[]Instruction, branch sy
 
 type syntaxCast struct {
 	origin syntaxBranch
-	into   []string
+	into   []Token
+	syntaxPos
 }
 
 func (s *syntaxCast) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
 	buffer := make([][]Instruction, 2)
-	o, e := s.origin.runIntoStack(p, &buffer[0])
+	o, e := runBranch(s.origin, p, &buffer[0])
 	if e != nil {
 		return nil, e
 	}
-	name, scope, e := getNameAndScope(p, s.into)
+	n, e := s.target(p, o)
 	if e != nil {
 		return nil, e
 	}
-	n, e := scope.FetchType(name)
-	if e != nil {
-		return nil, e
+	if kind, ok := runtimeKind(n); ok && o.Primitive() == ANY {
+		//Checked when run, it throws if the value is of another type
+		*stack = append(append(*stack, buffer[0]...), MKInstruction(ASK, kind))
+		return n, nil
 	}
-	if buffer[1], e = (*n).Create(); e != nil {
+	if buffer[1], e = n.Create(); e != nil {
 		return nil, e
 	}
 	var tp OBJType
 	result := make([]Instruction, 0)
-	if tp, e = p.solveFunctionCall("static_cast", false, []OBJType{o, *n}, buffer, &result); e != nil {
+	if tp, e = p.solveFunctionCall("static_cast", false, []OBJType{o, n}, buffer, &result); e != nil {
 		return nil, e
 	}
 	if len(result) > len(buffer[0])+len(buffer[1]) { //Only append type generation if there was a function call
@@ -281,12 +291,33 @@ func (s *syntaxCast) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, err
 	return tp, nil
 }
 
+//Generic structures without arguments take them from the casted value
+func (s *syntaxCast) target(p *Parser, from OBJType) (OBJType, error) {
+	route, e := getRoute(s.into)
+	if e != nil {
+		return solveContextedTypeFromTokens(s.into, p, false)
+	}
+	name, scope, e := getNameAndScope(p, route)
+	if e != nil {
+		return nil, e
+	}
+	n, e := scope.FetchType(name)
+	if e != nil {
+		return nil, e
+	}
+	if generic, ok := (*n).(*GenericStructure); ok {
+		return generic.Infer(from)
+	}
+	return *n, nil
+}
+
 type syntaxCall struct {
 	relation  *syntaxRoute
 	operands  []syntaxBranch
 	highLevel bool
 	spawned   bool
 	owner     *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -300,6 +331,7 @@ func (s *syntaxCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, err
 	if err != nil {
 		return nil, err
 	}
+	expectLambdas(scope, name, s.operands)
 	ops, stacks, err := runBranchesIntoStacks(p, s.operands)
 	if err != nil {
 		return nil, err
@@ -313,7 +345,7 @@ func (s *syntaxCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, err
 	if s.spawned {
 		if (*stack)[len(*stack)-1].Code == CLL {
 			(*stack)[len(*stack)-1].Code = CLT
-			ret = Void
+			ret = TaskOf(ret)
 		} else {
 			return nil, errors.New("Trying to spawn a function not enabled for so, wrap it as you need")
 		}
@@ -330,10 +362,62 @@ func (s *syntaxCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, err
 	return ret, nil
 }
 
+//Lambdas passed to a function take the types of their arguments from the parameter they are passed as,
+//when every function with that name and number of arguments agrees on it
+func expectLambdas(scope *Scope, name string, operands []syntaxBranch) {
+	symbols := scope.Functions.FindSymbol(name, len(operands))
+	template := scope.Functions.FindTemplate(name, len(operands))
+	for i, op := range operands {
+		lambda, ok := op.(*syntaxLambda)
+		if !ok {
+			continue
+		}
+		candidates := make([]OBJType, 0)
+		for _, sym := range symbols {
+			if i < len(sym.Args) && !(sym.Varargs && i >= len(sym.Args)-1) {
+				candidates = append(candidates, sym.Args[i])
+			}
+		}
+		if template != nil && i < len(template.Constraints) && template.Constraints[i] != nil {
+			candidates = append(candidates, template.Constraints[i])
+		}
+		lambda.expected, lambda.items = nil, template != nil && len(candidates) == 0
+		for _, c := range candidates {
+			fntp, ok := c.(*FunctionType)
+			if !ok || (lambda.expected != nil && !CompareTypes(fntp, lambda.expected)) {
+				lambda.expected = nil
+				break
+			}
+			lambda.expected = fntp
+		}
+	}
+}
+
+//Untyped lambdas of one argument passed to a template take the items of the first vector passed along,
+//as the iterators of std call them with
+func expectItems(branches []syntaxBranch, ops []OBJType) {
+	var items OBJType
+	for _, op := range ops {
+		if op != nil && op.Primitive() == VECTOR {
+			items = op.Items()
+			break
+		}
+	}
+	if items == nil {
+		return
+	}
+	for _, b := range branches {
+		if lambda, ok := b.(*syntaxLambda); ok && lambda.items {
+			lambda.expected = FunctionTypeOf([]OBJType{items}, nil).(*FunctionType)
+		}
+	}
+}
+
 type syntaxOpCall struct {
 	operator string
 	operands []syntaxBranch
 	owner    *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxOpCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -347,9 +431,33 @@ func (s *syntaxOpCall) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, e
 	if err != nil {
 		return nil, err
 	}
+	if s.operator == "&&" || s.operator == "||" {
+		if t, done, err := s.shortCircuit(p, ops, stacks, stack); done || err != nil {
+			return t, err
+		}
+	}
 	return p.solveFunctionCall(s.operator, true, ops, stacks, stack)
 }
 
+//Builtin boolean && and || only evaluate the right operand when the left one does not decide the result
+func (s *syntaxOpCall) shortCircuit(p *Parser, ops []OBJType, stacks [][]Instruction, stack *[]Instruction) (OBJType, bool, error) {
+	if len(ops) != 2 || ops[0].Primitive() != BOOL || ops[1].Primitive() != BOOL {
+		return nil, false, nil
+	}
+	sym, err := p.getSymbolForCall(s.operator, true, ops)
+	if err != nil || sym.CName != "none" {
+		return nil, false, err
+	}
+	var jump ICode = MVF
+	if s.operator == "||" {
+		jump = MVT
+	}
+	*stack = append(*stack, stacks[0]...)
+	*stack = append(*stack, MKInstruction(DUP), MKInstruction(jump, len(stacks[1])+1), MKInstruction(POP))
+	*stack = append(*stack, stacks[1]...)
+	return *sym.Return, true, nil
+}
+
 func (s *syntaxOpCall) runIntoStackSet(p *Parser, stack *[]Instruction, branch syntaxBranch) error {
 	if s.operator != INDEXOP.Data {
 		return errors.New("Cannot set")
@@ -366,6 +474,7 @@ type syntaxFnReference struct {
 	relation *syntaxRoute
 	args     []Token
 	owner    *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxFnReference) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -394,7 +503,53 @@ func (s *syntaxFnReference) runIntoStack(p *Parser, stack *[]Instruction) (OBJTy
 	}
 	p.closeScope()
 	fntp, cname := p.getFunctionTypeFrom(name, sym)
-	*stack = append(*stack, MKInstruction(PSH, cname))
+	ins, err := p.functionValue(cname)
+	if err != nil {
+		return nil, err
+	}
+	*stack = append(*stack, ins...)
+	return fntp, nil
+}
+
+type syntaxLambda struct {
+	args     []Token
+	children []Block
+	body     []Token       //Returned expression, only for the short form
+	expected *FunctionType //Type of the parameter it is passed as, if known, for untyped arguments
+	items    bool          //Passed to a template, the arguments may be the items of a vector passed along
+	owner    *SyntaxTree
+	syntaxPos
+}
+
+func (s *syntaxLambda) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
+	template := FunctionTemplate{Children: s.children, Expression: s.body, Pos: s.pos}
+	types := make([]OBJType, 0)
+	if len(s.args) > 0 {
+		args, tps, usetypes, varargs, err := p.parseArguments(lambdaArguments(s.args))
+		if err != nil {
+			return nil, err
+		}
+		if !usetypes {
+			if s.expected == nil || len(s.expected.args) != len(args) || varargs {
+				return nil, errors.New("Lambda arguments must be typed when their types can not be inferred")
+			}
+			tps = s.expected.args
+		}
+		template.Args, template.Varargs, types = args, varargs, tps
+	}
+	if !p.currentScope().IsGlobal() {
+		template.Outer = p.currentScope()
+	}
+	sym, err := p.generateFunctionFromRawTemplate("*lambda", false, types, &template)
+	if err != nil {
+		return nil, err
+	}
+	fntp, cname := p.getFunctionTypeFrom("*lambda", sym)
+	ins, err := p.functionValue(cname)
+	if err != nil {
+		return nil, err
+	}
+	*stack = append(*stack, ins...)
 	return fntp, nil
 }
 
@@ -402,6 +557,7 @@ type syntaxOpReference struct {
 	identifier string
 	args       []Token
 	owner      *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxOpReference) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -418,13 +574,18 @@ func (s *syntaxOpReference) runIntoStack(p *Parser, stack *[]Instruction) (OBJTy
 		return nil, err
 	}
 	fntp, cname := p.getFunctionTypeFrom(s.identifier, sym)
-	*stack = append(*stack, MKInstruction(PSH, cname))
+	ins, err := p.functionValue(cname)
+	if err != nil {
+		return nil, err
+	}
+	*stack = append(*stack, ins...)
 	return fntp, nil
 }
 
 type syntaxTypeCreation struct {
 	typeref []Token
 	owner   *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxTypeCreation) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
@@ -444,14 +605,53 @@ type syntaxAssignment struct {
 	value  syntaxBranch
 	assign syntaxBranchSet
 	owner  *SyntaxTree
+	syntaxPos
 }
 
 func (s *syntaxAssignment) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
 	return Void, s.assign.runIntoStackSet(p, stack, s.value)
 }
 
+//Assigns the parts of a value to already defined variables
+type syntaxPatternSet struct {
+	target pattern
+	owner  *SyntaxTree
+	syntaxPos
+}
+
+func (s *syntaxPatternSet) runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error) {
+	return nil, errors.New("A pattern can not be used as a value")
+}
+
+func (s *syntaxPatternSet) runIntoStackSet(p *Parser, stack *[]Instruction, branch syntaxBranch) error {
+	tp, err := runBranch(branch, p, stack)
+	if err != nil {
+		return err
+	}
+	return p.destructure(s.target, tp, false, false, stack)
+}
+
 type syntaxBranch interface {
 	runIntoStack(p *Parser, stack *[]Instruction) (OBJType, error)
+	position() Position
+}
+
+//Source position of the token that originated a branch
+type syntaxPos struct {
+	pos Position
+}
+
+func (s *syntaxPos) position() Position {
+	return s.pos
+}
+
+//Runs a branch pointing any error without location to the branch position
+func runBranch(b syntaxBranch, p *Parser, stack *[]Instruction) (OBJType, error) {
+	t, e := b.runIntoStack(p, stack)
+	if e != nil {
+		return nil, ErrorAt(b.position(), e)
+	}
+	return t, nil
 }
 
 type syntaxBranchSet interface {
@@ -479,16 +679,25 @@ func getNameAndScope(p *Parser, route []string) (name string, scope *Scope, err
 	return
 }
 
+//Lambdas run after the other operands, so they may take their argument types from them
 func runBranchesIntoStacks(p *Parser, branches []syntaxBranch) ([]OBJType, [][]Instruction, error) {
 	ops := make([]OBJType, len(branches))
 	stacks := make([][]Instruction, len(branches))
-	for i := len(branches) - 1; i >= 0; i-- {
-		var e error
-		if ops[i], e = branches[i].runIntoStack(p, &stacks[i]); e != nil {
-			return nil, nil, e
+	for _, lambdas := range []bool{false, true} {
+		if lambdas {
+			expectItems(branches, ops)
 		}
-		if ops[i].Primitive() == VOID {
-			return nil, nil, errors.New("Using Void as function argument")
+		for i := len(branches) - 1; i >= 0; i-- {
+			if _, ok := branches[i].(*syntaxLambda); ok != lambdas {
+				continue
+			}
+			var e error
+			if ops[i], e = runBranch(branches[i], p, &stacks[i]); e != nil {
+				return nil, nil, e
+			}
+			if ops[i].Primitive() == VOID {
+				return nil, nil, ErrorAt(branches[i].position(), errors.New("Using Void as function argument"))
+			}
 		}
 	}
 	return ops, stacks, nil
@@ -498,17 +707,18 @@ type SyntaxTree struct {
 	root     syntaxBranch
 	parser   *Parser
 	inReturn bool
+	children []Block //Block after the expression, taken by lambdas
 }
 
 func (s *SyntaxTree) runIntoStack(stack *[]Instruction) (OBJType, error) {
 	if s.root == nil {
 		return nil, errors.New("No expression node to parse")
 	}
-	return s.root.runIntoStack(s.parser, stack)
+	return runBranch(s.root, s.parser, stack)
 }
 
 func GenerateTree(parser *Parser, tks []Token, children []Block, returning bool) (tree *SyntaxTree, err error) {
-	tree = &SyntaxTree{nil, parser, returning}
+	tree = &SyntaxTree{nil, parser, returning, children}
 	if returning {
 		tree.root, err = tree.generateFirstLevelExpression(tks, children)
 	} else {
@@ -521,7 +731,7 @@ func (s *SyntaxTree) splitAssignmentExpression(tks []Token, children []Block) (s
 	if len(tks) == 0 {
 		return nil, errors.New("No expression to parse")
 	}
-	ttks, err := splitByToken(tks, func(tk Token) bool { return tk == ASSIGN }, genericPairs, false, false, false)
+	ttks, err := splitByToken(tks, func(tk Token) bool { return tk.Is(ASSIGN) }, genericPairs, false, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -536,12 +746,20 @@ func (s *SyntaxTree) splitAssignmentExpression(tks []Token, children []Block) (s
 		return rightterm, nil
 	}
 
+	if isPatternList(ttks[0]) {
+		target, err := parsePattern(ttks[0])
+		if err != nil {
+			return nil, err
+		}
+		setter := &syntaxPatternSet{target, s, syntaxPos{target.position()}}
+		return &syntaxAssignment{value: rightterm, assign: setter, owner: s, syntaxPos: syntaxPos{ttks[1][0].Pos}}, nil
+	}
 	leftterm, err := s.identifyExpressionBranch(ttks[0])
 	if err != nil {
 		return nil, err
 	}
 	if setter, v := leftterm.(syntaxBranchSet); v {
-		return &syntaxAssignment{value: rightterm, assign: setter, owner: s}, nil
+		return &syntaxAssignment{value: rightterm, assign: setter, owner: s, syntaxPos: syntaxPos{ttks[1][0].Pos}}, nil
 	}
 	return nil, errors.New("Cannot set")
 }
@@ -550,8 +768,18 @@ func (s *SyntaxTree) generateFirstLevelExpression(tks []Token, children []Block)
 	if len(tks) == 0 {
 		return
 	}
+	if isLambda(tks) {
+		return s.generateLambda(tks)
+	}
 	name, args, spawned := splitFirstLevelFunctionCall(tks)
 	if len(name) == 0 {
+		items, err := splitByToken(tks, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 1 { //Items separated by comas are a tuple without braces
+			return s.generateTupleDefinition(items, tks[0].Pos)
+		}
 		return s.generateSecondLevelExpression(tks) //No high level function
 	}
 	var route []string
@@ -562,13 +790,17 @@ func (s *SyntaxTree) generateFirstLevelExpression(tks []Token, children []Block)
 	if operands, err = s.generateOperands(args); err != nil {
 		return
 	}
-	return &syntaxCall{relation: &syntaxRoute{origin: nil, route: route}, operands: operands,
-		highLevel: true, spawned: spawned, owner: s}, nil
+	pos := syntaxPos{name[0].Pos}
+	return &syntaxCall{relation: &syntaxRoute{origin: nil, route: route, syntaxPos: pos}, operands: operands,
+		highLevel: true, spawned: spawned, owner: s, syntaxPos: pos}, nil
 }
 
 func (s *SyntaxTree) generateSecondLevelExpression(tks []Token) (syntaxBranch, error) {
-	if len(tks) > 0 && (tks[0] == FN || tks[0] == OP) {
-		return s.generateFunctionReference(discardOne(tks), tks[0] == OP)
+	if isLambda(tks) {
+		return s.generateLambda(tks)
+	}
+	if len(tks) > 0 && (tks[0].Is(FN) || tks[0].Is(OP)) {
+		return s.generateFunctionReference(tks[0], discardOne(tks), tks[0].Is(OP))
 	}
 	ttks, err := splitByToken(tks, func(tk Token) bool { return tk.Kind == OperatorToken }, genericPairs, true, true, false)
 	if err != nil {
@@ -577,10 +809,62 @@ func (s *SyntaxTree) generateSecondLevelExpression(tks []Token) (syntaxBranch, e
 	return s.generateOperatorBranch(ttks)
 }
 
-func (s *SyntaxTree) generateFunctionReference(tks []Token, op bool) (syntaxBranch, error) {
+//Lambdas are 'fn: args do' followed by a block or '|args| expression'
+func isLambda(tks []Token) bool {
+	if len(tks) > 1 && tks[0].Is(FN) {
+		return tks[1].Is(DOUBLES) || tks[1].Is(DO)
+	}
+	return len(tks) > 0 && (tks[0].Is(SPLITTER) || tks[0].Is(NOARGS))
+}
+
+func (s *SyntaxTree) generateLambda(tks []Token) (syntaxBranch, error) {
+	pos := syntaxPos{tks[0].Pos}
+	if tks[0].Is(FN) {
+		args, tail := readUntilToken(discardOne(tks), DO)
+		if next(args, DOUBLES) {
+			args = discardOne(args)
+		}
+		tail, err := expect(tail, DO)
+		if err != nil {
+			return nil, err
+		}
+		if err = unexpect(tail); err != nil {
+			return nil, err
+		}
+		if len(s.children) == 0 {
+			return nil, ErrorAt(tks[0].Pos, errors.New("Expecting lambda body"))
+		}
+		children := s.children
+		s.children = nil
+		return &syntaxLambda{args, children, nil, nil, false, s, pos}, nil
+	}
+	if tks[0].Is(NOARGS) {
+		if len(tks) == 1 {
+			return nil, ErrorAt(tks[0].Pos, errors.New("Expecting lambda body"))
+		}
+		return &syntaxLambda{nil, nil, tks[1:], nil, false, s, pos}, nil
+	}
+	//Types may contain '|' too, so the arguments end at the first bar that closes valid ones
+	for i := 1; i < len(tks)-1; i++ {
+		if tks[i].Is(SPLITTER) {
+			if _, _, _, _, err := s.parser.parseArguments(lambdaArguments(tks[1:i])); err == nil {
+				return &syntaxLambda{tks[1:i], nil, tks[i+1:], nil, false, s, pos}, nil
+			}
+		}
+	}
+	return nil, ErrorAt(tks[0].Pos, errors.New("Expecting lambda arguments closed by '|'"))
+}
+
+//Arguments in the form expected by parseArguments
+func lambdaArguments(args []Token) []Token {
+	tks := append([]Token{DOUBLES}, args...)
+	return append(tks, DO)
+}
+
+func (s *SyntaxTree) generateFunctionReference(ref Token, tks []Token, op bool) (syntaxBranch, error) {
 	id, args := readUntilToken(tks, DOUBLES)
-	if len(args) == 0 || args[0] != DOUBLES {
-		return nil, errors.New("Expecting token ':'")
+	if len(args) == 0 || !args[0].Is(DOUBLES) {
+		return nil, ErrorAt(ref.Pos, errors.New("Expecting token ':'"))
 	} else {
 		args = discardOne(args)
 	}
@@ -589,7 +873,7 @@ func (s *SyntaxTree) generateFunctionReference(tks []Token, op bool) (syntaxBran
 	if op {
 		var o Token
 		if o, id, e = expectT(id, OperatorToken); e == nil {
-			branch = &syntaxOpReference{o.Data, args, s}
+			branch = &syntaxOpReference{o.Data, args, s, syntaxPos{ref.Pos}}
 			id = discardOne(id)
 		}
 		if e == nil {
@@ -598,51 +882,63 @@ func (s *SyntaxTree) generateFunctionReference(tks []Token, op bool) (syntaxBran
 	} else {
 		var route []string
 		if route, e = getRoute(id); e == nil {
-			branch = &syntaxFnReference{&syntaxRoute{nil, route, s}, args, s}
+			branch = &syntaxFnReference{&syntaxRoute{nil, route, s, syntaxPos{ref.Pos}}, args, s, syntaxPos{ref.Pos}}
 		}
 	}
 	return branch, e
 }
 
-//we asume the odd positions are operators
+//we asume the odd positions are operators, an empty operand means the next operator is unary
 func (s *SyntaxTree) generateOperatorBranch(tks [][]Token) (syntaxBranch, error) {
 	if len(tks) == 0 {
 		return nil, errors.New("Expecting expression")
 	}
-	if len(tks) == 1 {
-		return s.identifyExpressionBranch(tks[0])
-	}
-	if len(tks) == 2 {
+	if len(tks)%2 == 0 {
 		return nil, errors.New("No operator sequence")
 	}
-	//Find first binary operator
-	p := -1
-	for i := 1; i < len(tks); i += 2 {
-		if len(tks[i-1]) != 0 {
-			p = i
+	idx := 0
+	return s.climbOperators(tks, &idx, 0)
+}
+
+//Groups binary operators by precedence, only those with level >= min are taken
+func (s *SyntaxTree) climbOperators(tks [][]Token, idx *int, min int) (syntaxBranch, error) {
+	left, err := s.operatorOperand(tks, idx)
+	for err == nil && *idx < len(tks) {
+		op := tks[*idx][0]
+		fixity := s.parser.currentScope().FixityOf(op.Data)
+		if fixity.Level < min {
 			break
 		}
+		next := fixity.Level + 1
+		if fixity.Right {
+			next = fixity.Level
+		}
+		*idx++
+		var right syntaxBranch
+		if right, err = s.climbOperators(tks, idx, next); err == nil {
+			left = &syntaxOpCall{operator: op.Data, operands: []syntaxBranch{left, right}, owner: s, syntaxPos: syntaxPos{op.Pos}}
+		}
 	}
-	if p < 0 { //Unary operator
-		op, err := s.generateOperatorBranch(tks[2:])
-		return &syntaxOpCall{
-			operator: tks[1][0].Data,
-			operands: []syntaxBranch{op},
-		}, err
+	return left, err
+}
+
+//Prefix unary operators bind tighter than any binary operator
+func (s *SyntaxTree) operatorOperand(tks [][]Token, idx *int) (syntaxBranch, error) {
+	if *idx >= len(tks) {
+		return nil, errors.New("Expecting expression")
 	}
-	left, err := s.generateOperatorBranch(tks[0:p])
-	if err != nil {
-		return nil, err
+	operand := tks[*idx]
+	*idx++
+	if len(operand) > 0 {
+		return s.identifyExpressionBranch(operand)
 	}
-	right, err := s.generateOperatorBranch(tks[p+1:])
-	if err != nil {
-		return nil, err
-	}
-	opb := syntaxOpCall{
-		operator: tks[p][0].Data,
-		operands: []syntaxBranch{left, right},
+	if *idx >= len(tks) {
+		return nil, errors.New("Expecting expression")
 	}
-	return &opb, nil
+	op := tks[*idx][0]
+	*idx++
+	inner, err := s.operatorOperand(tks, idx)
+	return &syntaxOpCall{operator: op.Data, operands: []syntaxBranch{inner}, owner: s, syntaxPos: syntaxPos{op.Pos}}, err
 }
 
 //Detects if it's an object literal, function call, etc and generates it
@@ -651,43 +947,36 @@ func (s *SyntaxTree) identifyExpressionBranch(tks []Token) (syntaxBranch, error)
 		return nil, errors.New("Expecting expression")
 	}
 	if route, e := getRoute(tks); e == nil {
-		return &syntaxRoute{nil, route, s}, nil
+		return &syntaxRoute{nil, route, s, syntaxPos{tks[0].Pos}}, nil
 	}
-	if tks[0] == DOUBLES && len(tks) > 0 && tks[1].Kind == IdToken {
-		str := &syntaxAtom{tks[1].Data, s}
+	if tks[0].Is(DOUBLES) && len(tks) > 0 && tks[1].Kind == IdToken {
+		str := &syntaxAtom{tks[1].Data, s, syntaxPos{tks[0].Pos}}
 		if len(tks) > 2 {
 			return s.identifySubrouting(str, tks[2:])
 		}
 		return str, nil
 	}
 	if isLiteral(tks[0]) {
-		literal := &syntaxLiteral{tks[0].Data, tks[0].Kind, s}
+		literal := &syntaxLiteral{tks[0].Data, tks[0].Kind, s, syntaxPos{tks[0].Pos}}
 		if len(tks) > 1 {
 			return s.identifySubrouting(literal, tks[1:])
 		}
 		return literal, nil
 	}
-	if tks[0] == CBOPEN {
+	if tks[0].Is(CBOPEN) {
 		_, inner, right, err := blockSubtract(tks, CBOPEN, CBCLOSE, genericPairs)
 		if err != nil {
 			return nil, err
 		}
-		args, err := splitByToken(inner, func(t Token) bool { return t == COMA }, genericPairs, false, false, false)
+		args, err := splitByToken(inner, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
 		if err != nil {
 			return nil, err
 		}
-		tupledef := syntaxTupleDefinition{elements: make([]syntaxBranch, 0), owner: s}
-		for _, arg := range args {
-			exp, err := s.generateSecondLevelExpression(arg)
-			if err != nil {
-				return nil, err
-			}
-			tupledef.elements = append(tupledef.elements, exp)
-		}
-		if len(right) > 0 {
-			return s.identifySubrouting(&tupledef, right)
+		tupledef, err := s.generateTupleDefinition(args, tks[0].Pos)
+		if len(right) > 0 && err == nil {
+			return s.identifySubrouting(tupledef, right)
 		}
-		return &tupledef, nil
+		return tupledef, err
 	}
 	left, inner, right, err := blockSubtract(tks, BOPEN, BCLOSE, genericPairs)
 	if err != nil {
@@ -702,20 +991,21 @@ func (s *SyntaxTree) identifyExpressionBranch(tks []Token) (syntaxBranch, error)
 		var preceded syntaxBranch
 		var e error
 		if len(left) == 0 { //Create type
-			preceded = &syntaxTypeCreation{inner, s}
+			preceded = &syntaxTypeCreation{inner, s, syntaxPos{tks[0].Pos}}
 		} else { //Indexation
 			route, err := getRoute(left)
 			if err != nil {
 				return nil, err
 			}
+			pos := syntaxPos{left[0].Pos}
 			if len(inner) == 1 && inner[0].Kind == IntegerToken {
 				i, err := strconv.Atoi(inner[0].Data)
 				e = err
-				preceded = &syntaxConstantAccess{target: &syntaxRoute{nil, route, s}, idx: i, owner: s}
+				preceded = &syntaxConstantAccess{target: &syntaxRoute{nil, route, s, pos}, idx: i, owner: s, syntaxPos: pos}
 			} else {
 				indexer, err := s.generateSecondLevelExpression(inner)
 				e = err
-				preceded = &syntaxOpCall{operator: INDEXOP.Data, operands: []syntaxBranch{&syntaxRoute{nil, route, s}, indexer}}
+				preceded = &syntaxOpCall{operator: INDEXOP.Data, operands: []syntaxBranch{&syntaxRoute{nil, route, s, pos}, indexer}, owner: s, syntaxPos: pos}
 			}
 		}
 		if len(right) == 0 || e != nil {
@@ -725,6 +1015,18 @@ func (s *SyntaxTree) identifyExpressionBranch(tks []Token) (syntaxBranch, error)
 	}
 }
 
+func (s *SyntaxTree) generateTupleDefinition(items [][]Token, pos Position) (syntaxBranch, error) {
+	tupledef := syntaxTupleDefinition{elements: make([]syntaxBranch, 0), owner: s, syntaxPos: syntaxPos{pos}}
+	for _, item := range items {
+		exp, err := s.generateSecondLevelExpression(item)
+		if err != nil {
+			return nil, err
+		}
+		tupledef.elements = append(tupledef.elements, exp)
+	}
+	return &tupledef, nil
+}
+
 func (s *SyntaxTree) identifySubrouting(preceded syntaxBranch, nexttks []Token) (syntaxBranch, error) {
 	left, inner, right, err := blockSubtract(nexttks, BOPEN, BCLOSE, genericPairs)
 	if err != nil {
@@ -734,18 +1036,14 @@ func (s *SyntaxTree) identifySubrouting(preceded syntaxBranch, nexttks []Token)
 	var e error
 	if len(left) == len(nexttks) {
 		if !next(left, DOT) {
-			route, e := getRoute(left)
-			if e != nil {
-				return nil, e
-			}
-			return &syntaxCast{preceded, route}, nil
+			return &syntaxCast{preceded, left, syntaxPos{left[0].Pos}}, nil
 		}
 		left = discardOne(left)
 		route, e := getRoute(left)
 		if e != nil {
 			return nil, e
 		}
-		return &syntaxRoute{preceded, route, s}, nil
+		return &syntaxRoute{preceded, route, s, syntaxPos{left[0].Pos}}, nil
 	} else {
 		branch := preceded
 		if len(left) != 0 {
@@ -756,16 +1054,16 @@ func (s *SyntaxTree) identifySubrouting(preceded syntaxBranch, nexttks []Token)
 			if e != nil {
 				return nil, e
 			}
-			branch = &syntaxRoute{preceded, route, s}
+			branch = &syntaxRoute{preceded, route, s, syntaxPos{left[0].Pos}}
 		}
 		if len(inner) == 1 && inner[0].Kind == IntegerToken {
 			i, err := strconv.Atoi(inner[0].Data)
 			e = err
-			idx = &syntaxConstantAccess{target: branch, idx: i, owner: s}
+			idx = &syntaxConstantAccess{target: branch, idx: i, owner: s, syntaxPos: syntaxPos{inner[0].Pos}}
 		} else {
 			indexer, err := s.generateSecondLevelExpression(inner)
 			e = err
-			idx = &syntaxOpCall{operator: INDEXOP.Data, operands: []syntaxBranch{branch, indexer}, owner: s}
+			idx = &syntaxOpCall{operator: INDEXOP.Data, operands: []syntaxBranch{branch, indexer}, owner: s, syntaxPos: syntaxPos{inner[0].Pos}}
 		}
 	}
 	if len(right) == 0 || e != nil {
@@ -792,7 +1090,7 @@ func (s *SyntaxTree) identifyParenthesisBranch(tks []Token) (syntaxBranch, error
 }
 
 func (s *SyntaxTree) generateFunctionCall(head []Token, callbody []Token) (syntaxBranch, error) {
-	args, err := splitByToken(callbody, func(t Token) bool { return t == COMA }, genericPairs, false, false, false)
+	args, err := splitByToken(callbody, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -800,7 +1098,9 @@ func (s *SyntaxTree) generateFunctionCall(head []Token, callbody []Token) (synta
 	if e != nil {
 		return nil, e
 	}
-	call := syntaxCall{relation: &syntaxRoute{origin: nil, route: route}, highLevel: false, spawned: false, operands: make([]syntaxBranch, 0), owner: s}
+	pos := syntaxPos{head[0].Pos}
+	call := syntaxCall{relation: &syntaxRoute{origin: nil, route: route, syntaxPos: pos}, highLevel: false, spawned: false,
+		operands: make([]syntaxBranch, 0), owner: s, syntaxPos: pos}
 	for _, arg := range args {
 		exp, err := s.generateSecondLevelExpression(arg)
 		if err != nil {
@@ -812,7 +1112,7 @@ func (s *SyntaxTree) generateFunctionCall(head []Token, callbody []Token) (synta
 }
 
 func (s *SyntaxTree) generateOperands(tks []Token) ([]syntaxBranch, error) {
-	ttks, err := splitByToken(tks, func(t Token) bool { return t == COMA }, genericPairs, false, false, false)
+	ttks, err := splitByToken(tks, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -842,7 +1142,7 @@ func splitFirstLevelFunctionCall(tks []Token) (name []Token, args []Token, spawn
 		name = tks[:split]
 		args = tks[split+1:]
 		if len(args) > 0 {
-			spawned = args[len(args)-1] == SPAWN
+			spawned = args[len(args)-1].Is(SPAWN)
 			if spawned {
 				args = args[:len(args)-1]
 			}
@@ -46,6 +46,66 @@ func wrapOpInstruction(code ICode, tp OBJType, unary bool) *FunctionSymbol {
 	return &FunctionSymbol{"none", false, MKInstruction(code).Fragment(), &tp, tps}
 }
 
+//Task handles are processes as well
+func isProcess(tp OBJType) bool {
+	return tp.Primitive() == PROCESS || tp.Primitive() == TASK
+}
+
+//Embedded function run with the calling process
+func processFunction(name string, ret OBJType, args []OBJType, fn func(proc *Process, args []Object) Object) *FunctionSymbol {
+	return &FunctionSymbol{"none", false, MKInstruction(IFD, EmbeddedFunction{
+		Name:     name,
+		ArgCount: len(args),
+		Blocking: fn,
+		Returns:  ret.Primitive() != VOID,
+	}).Fragment(), CloneType(ret), args}
+}
+
+func injectSyncFunctions(to *FunctionCollection) {
+	to.AddSymbol("lock", processFunction("lock", Void, []OBJType{Mutex}, func(proc *Process, args []Object) Object {
+		args[0].(*MutexT).Lock(proc)
+		return nil
+	}))
+	to.AddSymbol("unlock", processFunction("unlock", Void, []OBJType{Mutex}, func(proc *Process, args []Object) Object {
+		args[0].(*MutexT).Unlock(proc)
+		return nil
+	}))
+	to.AddSymbol("try_lock", processFunction("try_lock", Bool, []OBJType{Mutex}, func(proc *Process, args []Object) Object {
+		if args[0].(*MutexT).TryLock() {
+			return 1
+		}
+		return 0
+	}))
+	to.AddSymbol("load", processFunction("load", Int, []OBJType{AtomicInt}, func(proc *Process, args []Object) Object {
+		return args[0].(*AtomicIntT).Load()
+	}))
+	to.AddSymbol("store", processFunction("store", Void, []OBJType{AtomicInt, Int}, func(proc *Process, args []Object) Object {
+		args[0].(*AtomicIntT).Store(args[1].(int))
+		return nil
+	}))
+	to.AddSymbol("add", processFunction("add", Int, []OBJType{AtomicInt, Int}, func(proc *Process, args []Object) Object {
+		return args[0].(*AtomicIntT).Add(args[1].(int))
+	}))
+	to.AddSymbol("compare_and_swap", processFunction("compare_and_swap", Bool, []OBJType{AtomicInt, Int, Int}, func(proc *Process, args []Object) Object {
+		if args[0].(*AtomicIntT).CompareAndSwap(args[1].(int), args[2].(int)) {
+			return 1
+		}
+		return 0
+	}))
+	to.AddSymbol("add", processFunction("add", Void, []OBJType{WaitGroup, Int}, func(proc *Process, args []Object) Object {
+		args[0].(*WaitGroupT).Add(proc, args[1].(int))
+		return nil
+	}))
+	to.AddSymbol("done", processFunction("done", Void, []OBJType{WaitGroup}, func(proc *Process, args []Object) Object {
+		args[0].(*WaitGroupT).Add(proc, -1)
+		return nil
+	}))
+	to.AddSymbol("wait", processFunction("wait", Void, []OBJType{WaitGroup}, func(proc *Process, args []Object) Object {
+		args[0].(*WaitGroupT).Wait(proc)
+		return nil
+	}))
+}
+
 func injectBuiltinFunctions(to *FunctionCollection) {
 	to.AddDynamicSymbol("constructor", func(o []OBJType) *FunctionSymbol {
 		if len(o) == 1 {
@@ -68,9 +128,9 @@ func injectBuiltinFunctions(to *FunctionCollection) {
 			v := *args[0].(VecT)
 			for i, e := range v {
 				if i == len(v)-1 {
-					fmt.Println(e)
+					fmt.Println(Show(e))
 				} else {
-					fmt.Print(e)
+					fmt.Print(Show(e))
 				}
 			}
 			return nil
@@ -82,7 +142,7 @@ func injectBuiltinFunctions(to *FunctionCollection) {
 		ArgCount: 1,
 		Function: func(args []Object) Object {
 			for _, e := range *args[0].(VecT) {
-				fmt.Print(e)
+				fmt.Print(Show(e))
 			}
 			return nil
 		},
@@ -100,7 +160,7 @@ func injectBuiltinFunctions(to *FunctionCollection) {
 		Name:     "raw",
 		ArgCount: 1,
 		Function: func(args []Object) Object {
-			return fmt.Sprintf("%v", args[0])
+			return Show(args[0])
 		},
 		Returns: true,
 	}).Fragment(), CloneType(Str), []OBJType{Any}})
@@ -194,6 +254,151 @@ func injectBuiltinFunctions(to *FunctionCollection) {
 		return nil
 	})
 	to.AddSymbol("not", wrapOpInstruction(NOTB, Bool, true))
+	to.AddDynamicSymbol("join", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == TASK {
+			returns := 0
+			if o[0].Items().Primitive() != VOID {
+				returns = 1
+			}
+			return &FunctionSymbol{"none", false, MKInstruction(JON, nil, returns).Fragment(), CloneType(o[0].Items()), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("done?", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == TASK {
+			return &FunctionSymbol{"none", false, MKInstruction(TDN).Fragment(), CloneType(Bool), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("cancel", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && isProcess(o[0]) {
+			return &FunctionSymbol{"none", false, MKInstruction(TCN).Fragment(), CloneType(Void), o}
+		}
+		return nil
+	})
+	to.AddSymbol("trace", processFunction("trace", VecOf(Str), []OBJType{}, func(proc *Process, args []Object) Object {
+		return proc.RescuedTrace()
+	}))
+	to.AddSymbol("sleep", processFunction("sleep", Void, []OBJType{Int}, func(proc *Process, args []Object) Object {
+		proc.Sleep(time.Duration(args[0].(int)) * time.Millisecond)
+		return nil
+	}))
+	to.AddDynamicSymbol("with_timeout", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 2 && o[0].Primitive() == INTEGER && o[1].Primitive() == FUNCTION && len(o[1].(*FunctionType).args) == 0 {
+			return &FunctionSymbol{"none", false, []Instruction{MKInstruction(TMO), MKInstruction(CLL), MKInstruction(TMC)},
+				CloneType(o[1].(*FunctionType).ret), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("buffered", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 2 && o[0].Primitive() == CHANNEL && o[1].Primitive() == INTEGER {
+			return &FunctionSymbol{"none", false, []Instruction{MKInstruction(POP), MKInstruction(MCH)}, CloneType(o[0]), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("send", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 2 && o[0].Primitive() == CHANNEL && CompareTypes(o[0].Items(), o[1]) {
+			return &FunctionSymbol{"none", false, MKInstruction(SND).Fragment(), CloneType(Void), o}
+		}
+		if len(o) == 2 && isProcess(o[0]) && o[1].Primitive() != VOID {
+			return &FunctionSymbol{"none", false, MKInstruction(MSN).Fragment(), CloneType(Void), o}
+		}
+		return nil
+	})
+	to.AddSymbol("self", &FunctionSymbol{"none", false, MKInstruction(SLF).Fragment(), CloneType(Pid), []OBJType{}})
+	to.AddDynamicSymbol("pid", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == TASK {
+			return &FunctionSymbol{"none", false, []Instruction{}, CloneType(Pid), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("link", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && isProcess(o[0]) {
+			return &FunctionSymbol{"none", false, MKInstruction(LNK).Fragment(), CloneType(Void), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("monitor", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && isProcess(o[0]) {
+			return &FunctionSymbol{"none", false, MKInstruction(MON).Fragment(), CloneType(Void), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("receive", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == CHANNEL {
+			return &FunctionSymbol{"none", false, MKInstruction(RCV).Fragment(), CloneType(OptOf(o[0].Items())), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("try_receive", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == CHANNEL {
+			return &FunctionSymbol{"none", false, MKInstruction(TRC).Fragment(), CloneType(OptOf(o[0].Items())), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("close", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == CHANNEL {
+			return &FunctionSymbol{"none", false, MKInstruction(CCH).Fragment(), CloneType(Void), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("some", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() != NULL && o[0].Primitive() != VOID {
+			return &FunctionSymbol{"none", false, []Instruction{}, CloneType(OptOf(o[0])), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("unwrap", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == NULL {
+			return &FunctionSymbol{"none", false, []Instruction{
+				MKInstruction(DUP), MKInstruction(PSH, Null{}), MKInstruction(EQV), MKInstruction(MVF, 3),
+				MKInstruction(PSH, "Unwrapping none"), MKInstruction(CSE, 1), MKInstruction(TE, nil, RuntimeErrorType)},
+				CloneType(o[0].Items()), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("unwrap_or", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 2 && o[0].Primitive() == NULL && o[1].Primitive() != NULL && CompareTypes(o[0].Items(), o[1]) {
+			ret := o[0].Items()
+			if ret.Primitive() == ANY {
+				ret = o[1]
+			}
+			return &FunctionSymbol{"none", false, []Instruction{
+				MKInstruction(DUP), MKInstruction(PSH, Null{}), MKInstruction(EQV), MKInstruction(MVF, 2),
+				MKInstruction(POP), MKInstruction(MVR, 2), MKInstruction(SWT), MKInstruction(POP)}, CloneType(ret), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("is_none", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == NULL {
+			return &FunctionSymbol{"none", false, []Instruction{MKInstruction(PSH, Null{}), MKInstruction(EQV)}, CloneType(Bool), o}
+		}
+		return nil
+	})
+	to.AddDynamicSymbol("is_some", func(o []OBJType) *FunctionSymbol {
+		if len(o) == 1 && o[0].Primitive() == NULL {
+			return &FunctionSymbol{"none", false, []Instruction{
+				MKInstruction(PSH, Null{}), MKInstruction(EQV), MKInstruction(NOTB)}, CloneType(Bool), o}
+		}
+		return nil
+	})
+}
+
+func injectBuiltinFixities(to map[string]Fixity) {
+	levels := [][]string{
+		{"->"},
+		{"||"},
+		{"^^"},
+		{"&&"},
+		{"==", "!=", "<", ">", "<=", ">="},
+		{"+", "-", "|", "^"},
+		{"*", "/", "%", "<<", ">>", "&"},
+	}
+	for i, operators := range levels {
+		for _, op := range operators {
+			to[op] = Fixity{i + 1, false}
+		}
+	}
 }
 
 func injectBuiltinOperators(to *FunctionCollection) {
@@ -229,7 +434,7 @@ func injectBuiltinOperators(to *FunctionCollection) {
 				ret = CloneType(o[0].Items())
 			} else if o[0].Primitive() == MAP && o[1].Primitive() == STRING {
 				ins = []Instruction{MKInstruction(PRP)}
-				ret = CloneType(TupleOf([]OBJType{o[0].Items(), Bool}))
+				ret = CloneType(OptOf(o[0].Items()))
 			} else {
 				return nil
 			}
@@ -37,6 +37,9 @@ func (p *Parser) parseImport(block Block) error {
 				return e
 			}
 			if next(tks, OP) {
+				if e := p.currentScope().ImportFixities(scope); e != nil {
+					return e
+				}
 				if e := p.currentScope().Operators.CopyFrom(scope.Operators); e != nil {
 					return e
 				}
@@ -64,6 +67,17 @@ func (p *Parser) parseFunction(block Block, operator bool) error {
 	if e != nil {
 		return e
 	}
+	if operator && (nextV(tks, "infixl") || nextV(tks, "infixr")) {
+		if tks, e = p.parseFixity(name, tks); e != nil {
+			return e
+		}
+		if !isNext(tks) { //Only declares the precedence
+			if len(block.Children) > 0 {
+				return errors.New("Precedence declaration can not have a body")
+			}
+			return nil
+		}
+	}
 	var args []string
 	var types []OBJType
 	var usetypes bool
@@ -92,7 +106,17 @@ func (p *Parser) parseFunction(block Block, operator bool) error {
 	if operator && varargs {
 		return errors.New("Operator can not have varargs")
 	}
-	template := FunctionTemplate{Args: args, Varargs: varargs, Children: block.Children}
+	template := FunctionTemplate{Args: args, Varargs: varargs, Children: block.Children, Pos: name.Pos}
+	for _, tp := range types {
+		if tp.Primitive() == INTERFACE { //Remains a template, checked when instanced
+			template.Constraints = types
+			usetypes = false
+			break
+		}
+	}
+	if !p.currentScope().IsGlobal() {
+		template.Outer = p.currentScope()
+	}
 	if usetypes {
 		_, e = p.generateFunctionFromRawTemplate(name.Data, operator, types, &template)
 	} else {
@@ -101,9 +125,23 @@ func (p *Parser) parseFunction(block Block, operator bool) error {
 	return e
 }
 
+//Reads 'infixl level' or 'infixr level' after the operator name
+func (p *Parser) parseFixity(name Token, tks []Token) ([]Token, error) {
+	right := tks[0].Data == "infixr"
+	level, tks, e := expectT(discardOne(tks), IntegerToken)
+	if e != nil {
+		return nil, e
+	}
+	n, e := strconv.Atoi(level.Data)
+	if e != nil || n < 0 || n > 9 {
+		return nil, ErrorAt(level.Pos, errors.New("Precedence level must be between 0 and 9"))
+	}
+	return tks, ErrorAt(name.Pos, p.currentScope().DeclareFixity(name.Data, Fixity{n, right}))
+}
+
 func (p *Parser) parseDefinition(block Block, constant bool) error {
-	tks := discardOne(block.Tokens)
-	id, tks, e := expectT(tks, IdToken)
+	left, tks := readUntilToken(discardOne(block.Tokens), ASSIGN)
+	target, e := parsePattern(left)
 	if e != nil {
 		return e
 	}
@@ -111,34 +149,29 @@ func (p *Parser) parseDefinition(block Block, constant bool) error {
 	if e != nil {
 		return e
 	}
-	ret, e := p.parseExpression(tks, block.Children, false)
+	ret, stack, e := p.parseExpressionInto(tks, block.Children, false)
 	if e != nil {
 		return e
 	}
 	if ret.Primitive() == VOID {
 		return errors.New("Void can not be assigned as a value")
 	}
-	p.currentScope().CreateVariable(id.Data, ret, !constant, false)
-	ins, e := p.currentScope().SetVariableIns(id.Data, ret)
-	if e != nil {
+	if e = p.destructure(target, ret, true, !constant, &stack); e != nil {
 		return e
 	}
-	p.addInstruction(ins)
-	if ret.Primitive() == FUNCTION {
-		if !constant {
-			return errors.New("Function declaration must be constant")
-		}
-		if e = p.functionFromVariable(id.Data); e != nil {
-			return e
-		}
-	}
+	p.addInstructions(stack)
 	return nil
 }
 
 func (p *Parser) parseReturn(block Block) error {
-	tks := discardOne(block.Tokens)
+	return p.parseReturnOf(discardOne(block.Tokens), block.Children)
+}
+
+func (p *Parser) parseReturnOf(tks []Token, children []Block) error {
+	//Tail calls would skip the cleanup of the open regions
+	guarded := p.currentScope().guards != nil
 	if len(tks) != 0 {
-		ret, e := p.parseExpression(tks, block.Children, true)
+		ret, e := p.parseExpression(tks, children, !guarded)
 		if e != nil {
 			return e
 		}
@@ -150,6 +183,11 @@ func (p *Parser) parseReturn(block Block) error {
 			return e
 		}
 	}
+	if guarded {
+		if e := p.leaveGuards(nil, false); e != nil {
+			return e
+		}
+	}
 	p.addInstruction(MKInstruction(RET))
 	*p.currentScope().returnLnFlag = returnLnFlag{true, true}
 	return nil
@@ -189,6 +227,9 @@ func (p *Parser) parseDirectLine(tks []Token) error {
 				} else if t.Data == FALSE.Data {
 					objs = append(objs, 0)
 					break
+				} else if t.Data == NONE.Data {
+					objs = append(objs, Null{})
+					break
 				}
 				fallthrough
 			default:
@@ -221,14 +262,27 @@ func (p *Parser) parseDirect(block Block) error {
 }
 
 func (p *Parser) parseIf(tks []Token, children []Block, scp ScopeCtx) error {
+	flags := p.currentScope().ifFlags
+	if flags.chain == nil {
+		flags.chain = &ifChain{pos: tks[0].Pos}
+	}
 	tks = discardOne(tks)
 	tks, r := readUntilToken(tks, DO)
-	tp, e := p.parseExpression(tks, nil, false)
-	if e != nil {
-		return e
-	}
-	if tp.Primitive() != BOOL {
-		return errors.New("Expecting boolean expression")
+	var bind func() error
+	if next(tks, VAL) {
+		var e error
+		if bind, e = p.parseConditionalPattern(discardOne(tks), flags.chain); e != nil {
+			return e
+		}
+	} else {
+		tp, e := p.parseExpression(tks, nil, false)
+		if e != nil {
+			return e
+		}
+		if tp.Primitive() != BOOL {
+			return ErrorAt(tks[0].Pos, errors.New("Expecting boolean expression"))
+		}
+		flags.chain.broken = true
 	}
 	tail, e := expect(r, DO)
 	if e != nil {
@@ -240,6 +294,11 @@ func (p *Parser) parseIf(tks []Token, children []Block, scp ScopeCtx) error {
 	editpoint := p.addInstruction(MKInstruction(MVF))
 	begin := p.fragmentSize()
 	p.openScope()
+	if bind != nil {
+		if e = bind(); e != nil {
+			return e
+		}
+	}
 	e = p.parseBlocks(children, scp)
 	if e != nil {
 		return e
@@ -253,6 +312,52 @@ func (p *Parser) parseIf(tks []Token, children []Block, scp ScopeCtx) error {
 	return nil
 }
 
+//Leaves on the stack whether the pattern matched, the returned function binds it inside the if scope
+func (p *Parser) parseConditionalPattern(tks []Token, chain *ifChain) (func() error, error) {
+	left, right := readUntilToken(tks, ASSIGN)
+	pt, e := parsePattern(left)
+	if e != nil {
+		return nil, e
+	}
+	if right, e = expect(right, ASSIGN); e != nil {
+		return nil, e
+	}
+	tp, e := p.parseExpression(right, nil, false)
+	if e != nil {
+		return nil, e
+	}
+	if tp.Primitive() == VOID {
+		return nil, errors.New("Void can not be matched")
+	}
+	//An optional is narrowed to its value unless the pattern already tells them apart
+	if tp.Primitive() == NULL {
+		switch pt.(type) {
+		case *somePattern, *valuePattern, *wildcardPattern:
+		default:
+			pt = &somePattern{pt, syntaxPos{left[0].Pos}}
+		}
+	}
+	subject := ""
+	for _, t := range right {
+		subject += t.Data + " "
+	}
+	chain.add(subject, pt, tp)
+	scrutinee := p.currentScope().CreateHiddenVariable("if", tp)
+	p.addInstruction(MKInstruction(SLI, scrutinee))
+	load := []Instruction{MKInstruction(LLI, scrutinee)}
+	fails := make([]int, 0)
+	if e = p.testPattern(pt, tp, load, &fails); e != nil {
+		return nil, e
+	}
+	p.addInstructions([]Instruction{MKInstruction(PSH, 1), MKInstruction(MVR, 1)})
+	failed := p.fragmentSize()
+	for _, f := range fails {
+		p.editInstruction(f, MKInstruction(MVF, failed-f-1))
+	}
+	p.addInstruction(MKInstruction(PSH, 0))
+	return func() error { return p.bindPattern(pt, tp, load) }, nil
+}
+
 func (p *Parser) parseElse(block Block, scp ScopeCtx) error {
 	if !p.currentScope().ifFlags.afterif {
 		return errors.New("Unexpected block else")
@@ -284,6 +389,7 @@ func (p *Parser) parseElse(block Block, scp ScopeCtx) error {
 		if e := unexpect(tail); e != nil {
 			return e
 		}
+		p.currentScope().ifFlags.chain = nil
 		p.openScope()
 		e = p.parseBlocks(block.Children, scp)
 		if e != nil {
@@ -312,7 +418,7 @@ func (p *Parser) parseWhile(block Block) error {
 		return e
 	}
 	if tp.Primitive() != BOOL {
-		return errors.New("Expecting boolean expression")
+		return ErrorAt(tks[0].Pos, errors.New("Expecting boolean expression"))
 	}
 	{
 		tail, e := expect(r, DO)
@@ -337,7 +443,8 @@ func (p *Parser) parseWhile(block Block) error {
 	end := p.fragmentSize()
 	p.addInstruction(MKInstruction(MVR, whilestart-end-1))
 	p.editInstruction(editpoint, MKInstruction(MVF, end-begin+1))
-	p.currentScope().loopInfo.solveJumps(p, whilestart+1, end)
+	//Jumps land after the position given, so continue starts again from the first instruction of the condition
+	p.currentScope().loopInfo.solveJumps(p, whilestart-1, end)
 	p.currentScope().closeLoopInfo()
 	return nil
 }
@@ -345,7 +452,7 @@ func (p *Parser) parseWhile(block Block) error {
 func (p *Parser) parseFor(block Block) error {
 	tks := discardOne(block.Tokens)
 	tks, r := readUntilToken(tks, DO)
-	sides, e := splitByToken(tks, func(t Token) bool { return t == IN }, []struct {
+	sides, e := splitByToken(tks, func(t Token) bool { return t.Is(IN) }, []struct {
 		open  Token
 		close Token
 	}{{POPEN, PCLOSE}, {BOPEN, BCLOSE}}, false, false, false)
@@ -353,7 +460,7 @@ func (p *Parser) parseFor(block Block) error {
 		return e
 	}
 	if len(sides) != 2 {
-		return errors.New("Expecting 'in' keyword")
+		return ErrorAt(block.Tokens[0].Pos, errors.New("Expecting 'in' keyword"))
 	}
 	itertp, e := p.parseExpression(sides[1], nil, false)
 	var name string
@@ -443,7 +550,6 @@ func (p *Parser) parseLoopJump(block Block, skip bool) error {
 	if err = unexpect(line); err != nil {
 		return err
 	}
-	idx := p.addInstruction(MKInstruction(MVR))
 	info := p.currentScope().loopInfo
 	for loopTarget > 0 {
 		if info.father == nil {
@@ -452,7 +558,10 @@ func (p *Parser) parseLoopJump(block Block, skip bool) error {
 		info = info.father
 		loopTarget--
 	}
-	info.insertJump(idx, skip)
+	if err = p.leaveGuards(info.guards, true); err != nil {
+		return err
+	}
+	info.insertJump(p.addInstruction(MKInstruction(MVR)), skip)
 	return nil
 }
 
@@ -637,7 +746,7 @@ func (p *Parser) parseDropFn(block Block) error {
 			if tks, e = expect(tks, FOR); e != nil {
 				return e
 			}
-			types, e := splitByToken(tks, func(tk Token) bool { return tk == COMA }, []struct {
+			types, e := splitByToken(tks, func(tk Token) bool { return tk.Is(COMA) }, []struct {
 				open  Token
 				close Token
 			}{{CBOPEN, CBCLOSE}}, false, false, false)
@@ -684,15 +793,35 @@ func (p *Parser) parseStruct(block Block) error {
 	if err != nil {
 		return err
 	}
+	params := make([]string, 0)
+	for next(tks, SPLITTER) {
+		var param Token
+		if param, tks, err = expectT(discardOne(tks), IdToken); err != nil {
+			return err
+		}
+		params = append(params, param.Data)
+	}
 	tks, err = expect(tks, DOUBLES)
 	if err != nil {
 		return err
 	}
-	tps, err := splitByToken(tks, func(tk Token) bool { return tk == COMA }, genericPairs, false, false, false)
+	tps, err := splitByToken(tks, func(tk Token) bool { return tk.Is(COMA) }, genericPairs, false, false, false)
 	count := 0
 	structure := StructOf(make([]OBJType, 0), make(map[string]int),
 		name.Data, p.currentScope().DataModule).(*Structure)
-	if err = p.currentScope().NewType(name.Data, structure); err != nil {
+	var defined OBJType = structure
+	if len(params) > 0 {
+		defined = GenericStructOf(params, structure)
+		//Parameters are types only while the fields are solved
+		for i, param := range params {
+			if _, e := p.currentScope().DefinedTypes[param]; e {
+				return fmt.Errorf("Type parameter %s collides with an existing type", param)
+			}
+			p.currentScope().DefinedTypes[param] = CloneType(&TypeParameter{param, i, p.currentScope().DataModule})
+			defer delete(p.currentScope().DefinedTypes, param)
+		}
+	}
+	if err = p.currentScope().NewType(name.Data, defined); err != nil {
 		return err
 	}
 	var ptr *OBJType
@@ -745,6 +874,142 @@ func (p *Parser) parseStruct(block Block) error {
 	return nil
 }
 
+func (p *Parser) parseEnum(block Block) error {
+	tks := discardOne(block.Tokens)
+	name, tks, err := expectT(tks, IdToken)
+	if err != nil {
+		return err
+	}
+	tks, err = expect(tks, DOUBLES)
+	if err != nil {
+		return err
+	}
+	variants, err := splitByToken(tks, func(tk Token) bool { return tk.Is(COMA) }, genericPairs, false, false, false)
+	if err != nil {
+		return err
+	}
+	enum := EnumOf(name.Data, p.currentScope().DataModule).(*Enum)
+	if err = p.currentScope().NewType(name.Data, enum); err != nil {
+		return err
+	}
+	for _, tk := range variants {
+		var variant Token
+		if variant, tk, err = expectT(tk, IdToken); err != nil {
+			return err
+		}
+		if _, e := enum.Variant(variant.Data); e {
+			return ErrorAt(variant.Pos, fmt.Errorf("Variant %s already exists", variant.Data))
+		}
+		fields := make([]OBJType, 0)
+		if isNext(tk) {
+			var tp OBJType
+			if tp, err = solveContextedTypeFromTokens(tk, p, true); err != nil {
+				return err
+			}
+			if tp.Primitive() != TUPLE {
+				return ErrorAt(tk[0].Pos, errors.New("Variant fields must be a tuple type"))
+			}
+			fields = tp.FixedItems()
+		}
+		enum.Variants = append(enum.Variants, variant.Data)
+		enum.Fields = append(enum.Fields, fields)
+		//The variant tag goes before the fields
+		constructor := &FunctionSymbol{"none", false,
+			[]Instruction{MKInstruction(PSH, variant.Data), MKInstruction(CSE, len(fields)+1)}, CloneType(enum), fields}
+		if err = p.currentScope().Functions.AddSymbol(variant.Data, constructor); err != nil {
+			return ErrorAt(variant.Pos, err)
+		}
+	}
+	if len(enum.Variants) == 0 {
+		return errors.New("Expecting at least one variant")
+	}
+	return nil
+}
+
+func (p *Parser) parseInterface(block Block) error {
+	tks := discardOne(block.Tokens)
+	name, tks, err := expectT(tks, IdToken)
+	if err != nil {
+		return err
+	}
+	tks, err = expect(tks, DOUBLES)
+	if err != nil {
+		return err
+	}
+	iface := InterfaceOf(name.Data, p.currentScope().DataModule).(*Interface)
+	if err = p.currentScope().NewType(name.Data, iface); err != nil {
+		return err
+	}
+	//Self is a type only while the requirements are solved
+	if _, e := p.currentScope().DefinedTypes["Self"]; e {
+		return errors.New("Type Self collides with the interface parameter")
+	}
+	p.currentScope().DefinedTypes["Self"] = CloneType(&TypeParameter{"Self", 0, p.currentScope().DataModule})
+	defer delete(p.currentScope().DefinedTypes, "Self")
+	for len(tks) > 0 {
+		end := 1
+		for end < len(tks) && !tks[end].Is(FN) && !tks[end].Is(OP) {
+			end++
+		}
+		requirement, err := p.parseRequirement(tks[:end])
+		if err != nil {
+			return err
+		}
+		iface.Requirements = append(iface.Requirements, requirement)
+		tks = tks[end:]
+	}
+	if len(iface.Requirements) == 0 {
+		return errors.New("Expecting at least one function")
+	}
+	return nil
+}
+
+//Reads 'fn name: Types -> Return' with optional return, the separating coma is discarded
+func (p *Parser) parseRequirement(tks []Token) (r Requirement, err error) {
+	if !tks[0].Is(FN) && !tks[0].Is(OP) {
+		err = ErrorAt(tks[0].Pos, fmt.Errorf("Unexpected token: %s", tks[0].Data))
+		return
+	}
+	r.Operator = tks[0].Is(OP)
+	var name Token
+	if r.Operator {
+		name, tks, err = expectT(discardOne(tks), OperatorToken)
+	} else {
+		name, tks, err = expectT(discardOne(tks), IdToken)
+	}
+	if err != nil {
+		return
+	}
+	r.Name = name.Data
+	if len(tks) > 0 && tks[len(tks)-1].Is(COMA) {
+		tks = tks[:len(tks)-1]
+	}
+	args, ret := readUntilToken(tks, ARROW)
+	if next(args, DOUBLES) {
+		var tps [][]Token
+		if tps, err = splitByToken(discardOne(args), func(tk Token) bool { return tk.Is(COMA) }, genericPairs, false, false, false); err != nil {
+			return
+		}
+		for _, tk := range tps {
+			var tp OBJType
+			if tp, err = solveContextedTypeFromTokens(tk, p, true); err != nil {
+				return
+			}
+			r.Args = append(r.Args, tp)
+		}
+	} else if err = unexpect(args); err != nil {
+		return
+	}
+	if r.Operator && (len(r.Args) > 2 || len(r.Args) < 1) {
+		err = ErrorAt(name.Pos, errors.New("Operator must be unary or binary"))
+		return
+	}
+	if len(ret) > 0 {
+		r.Return, err = solveContextedTypeFromTokens(discardOne(ret), p, true)
+	}
+	return
+}
+
 func (p *Parser) parseThrow(block Block) error {
 	tks := discardOne(block.Tokens)
 	if len(tks) > 0 {
@@ -755,67 +1020,380 @@ func (p *Parser) parseThrow(block Block) error {
 		if ret.Primitive() == VOID {
 			return errors.New("Can not throw Void")
 		}
-		p.addInstruction(MKInstruction(TE))
+		p.addInstruction(MKInstruction(TE, nil, TypeId(ret)))
 	} else {
-		p.addInstruction(MKInstruction(TE, ""))
+		p.addInstruction(MKInstruction(TE, "", TypeId(Str)))
 	}
 	return nil
 }
 
-func (p *Parser) parseRescue(block Block) error {
+//The rest of the enclosing block is protected, after the handler the execution continues at the end of the block
+func (p *Parser) parseRescue(block Block, scp ScopeCtx) error {
 	tks := discardOne(block.Tokens)
 	id, tks, err := expectT(tks, IdToken)
 	if err != nil {
 		return err
 	}
-	args := []string{id.Data}
-	tps := []OBJType{*CloneType(Str)}
-	exported := -1
-	if next(tks, IMPORT) {
-		tks = discardOne(tks)
-		id, tks, err = expectT(tks, IdToken)
-		if err != nil {
-			return err
-		}
-		args = append(args, id.Data)
-		var tp OBJType
-		var i Instruction
-		if i, tp, err = p.currentScope().GetVariableIns(id.Data); err != nil {
+	tks, r := readUntilToken(tks, DO)
+	if err = expectBlockOpening(r); err != nil {
+		return err
+	}
+	//Without a type any error is rescued as its message
+	tp, kind := Str, ""
+	if len(tks) > 0 {
+		if tp, err = solveContextedTypeFromTokens(tks, p, false); err != nil {
 			return err
 		}
-		if i.Code == LLI {
-			exported = i.Inspect()[0].(int) + 128 //(1 << 7)
-		} else if i.Code == LEI {
-			exported = i.Inspect()[0].(int)
-		} else {
-			return errors.New("Unexpected variable kind")
-		}
-		tps = append(tps, tp)
+		kind = TypeId(tp)
 	}
-	tks, err = expect(tks, DO)
+	p.addInstruction(MKInstruction(RE, 1, kind))
+	skip := p.addInstruction(MKInstruction(MVR))
+	begin := p.fragmentSize()
+	p.openScope()
+	p.currentScope().CreateVariable(id.Data, tp, false, false)
+	//As arguments, the error may be ignored
+	p.currentScope().Variables[id.Data].Used = true
+	set, err := p.currentScope().SetVariableIns(id.Data, tp)
 	if err != nil {
 		return err
 	}
-	if err = unexpect(tks); err != nil {
+	p.addInstruction(set)
+	if err = p.parseBlocks(block.Children, scp); err != nil {
 		return err
 	}
-	template := FunctionTemplate{Args: args, Varargs: false, Children: block.Children}
-	sym, err := p.generateFunctionFromRawTemplate("*rescue", false, tps, &template)
-	if err != nil {
+	returned := p.currentScope().returnLnFlag.isreturn
+	if err = p.closeScope(); err != nil {
 		return err
 	}
-	if err = p.currentScope().updateReturn(*sym.Return); err != nil {
+	g := &guard{p.currentScope().guards, nil, scp, nil}
+	if !returned {
+		g.handlers = append(g.handlers, p.addInstruction(MKInstruction(MVR)))
+	}
+	p.editInstruction(skip, MKInstruction(MVR, p.fragmentSize()-begin))
+	p.currentScope().guards = g
+	return nil
+}
+
+//The cleanup runs when the rest of the enclosing block is left, even by an exception that is thrown again after it
+func (p *Parser) parseEnsure(block Block, scp ScopeCtx) error {
+	if err := expectBlockOpening(discardOne(block.Tokens)); err != nil {
 		return err
 	}
-	if p.currentScope().hasRescue {
-		return errors.New("Rescue already setted up for this function")
-	} else {
-		p.currentScope().hasRescue = true
+	g := &guard{p.currentScope().guards, block.Children, scp, nil}
+	p.addInstruction(MKInstruction(RE, 1, AnyException))
+	skip := p.addInstruction(MKInstruction(MVR))
+	begin := p.fragmentSize()
+	p.openScope()
+	exception := p.currentScope().CreateHiddenVariable("exception", Any)
+	p.addInstruction(MKInstruction(SLI, exception))
+	if err := p.runEnsure(g); err != nil {
+		return err
+	}
+	p.addInstructions([]Instruction{MKInstruction(LLI, exception), MKInstruction(TE, nil, "")})
+	if err := p.closeScope(); err != nil {
+		return err
 	}
-	p.addInstruction(MKInstruction(RE, sym.CName, exported))
+	p.editInstruction(skip, MKInstruction(MVR, p.fragmentSize()-begin))
+	p.currentScope().guards = g
 	return nil
 }
 
+//Emits the cleanup of a region, regions that are still open around it are the only ones seen from the cleanup
+func (p *Parser) runEnsure(g *guard) error {
+	scope := p.currentScope()
+	guards := scope.guards
+	scope.guards = g.parent
+	p.openScope()
+	if err := p.parseBlocks(g.ensure, g.scp); err != nil {
+		return err
+	}
+	if err := p.closeScope(); err != nil {
+		return err
+	}
+	scope.guards = guards
+	return nil
+}
+
+//Leaves the regions opened after base, discard removes their rescue points
+func (p *Parser) leaveGuards(base *guard, discard bool) error {
+	for g := p.currentScope().guards; g != base; g = g.parent {
+		if g == nil {
+			return errors.New("Unexpected region nesting")
+		}
+		if discard {
+			p.addInstruction(MKInstruction(DR))
+		}
+		if g.ensure != nil {
+			if err := p.runEnsure(g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Closes the regions opened in the block, the handlers jump right after the rescue point of their region is discarded
+func (p *Parser) closeGuards(base *guard) error {
+	scope := p.currentScope()
+	for scope.guards != base {
+		g := scope.guards
+		p.addInstruction(MKInstruction(DR))
+		if len(g.handlers) > 0 {
+			//The block may end without returning
+			*scope.returnLnFlag = returnLnFlag{true, false}
+		}
+		for _, h := range g.handlers {
+			p.editInstruction(h, MKInstruction(MVR, p.fragmentSize()-h-1))
+		}
+		if g.ensure != nil {
+			if err := p.runEnsure(g); err != nil {
+				return err
+			}
+		}
+		scope.guards = g.parent
+	}
+	return nil
+}
+
+func (p *Parser) parseMatch(block Block, scp ScopeCtx) error {
+	tks, r := readUntilToken(discardOne(block.Tokens), DO)
+	tp, e := p.parseExpression(tks, nil, false)
+	if e != nil {
+		return e
+	}
+	if tp.Primitive() == VOID {
+		return errors.New("Void can not be matched")
+	}
+	if e = expectBlockOpening(r); e != nil {
+		return e
+	}
+	p.openScope()
+	scrutinee := p.currentScope().CreateHiddenVariable("match", tp)
+	p.addInstruction(MKInstruction(SLI, scrutinee))
+	ends := make([]int, 0)
+	coverage := newVariantCoverage(tp)
+	//Every value is handled when the type is an enum, as it is checked, or when the last arm always matches
+	exhaustive, returns := tp.Primitive() == ENUM, true
+	for i, arm := range block.Children {
+		head, r := readUntilToken(arm.Tokens, DO)
+		if e = expectBlockOpening(r); e != nil {
+			return ErrorAt(arm.Tokens[0].Pos, e)
+		}
+		pt, e := parsePattern(head)
+		if e != nil {
+			return ErrorAt(arm.Tokens[0].Pos, e)
+		}
+		fails := make([]int, 0)
+		load := []Instruction{MKInstruction(LLI, scrutinee)}
+		if e = p.testPattern(pt, tp, load, &fails); e != nil {
+			return e
+		}
+		coverage.cover(pt, tp)
+		if len(fails) == 0 && i < len(block.Children)-1 {
+			return ErrorAt(block.Children[i+1].Tokens[0].Pos, errors.New("Unreachable match arm"))
+		}
+		exhaustive = exhaustive || len(fails) == 0
+		p.openScope()
+		if e = p.bindPattern(pt, tp, load); e != nil {
+			return e
+		}
+		if e = p.parseBlocks(arm.Children, scp); e != nil {
+			return e
+		}
+		returns = returns && p.currentScope().returnLnFlag.isreturn
+		if e = p.closeScope(); e != nil {
+			return e
+		}
+		if i < len(block.Children)-1 {
+			ends = append(ends, p.addInstruction(MKInstruction(MVR)))
+		}
+		next := p.fragmentSize()
+		for _, f := range fails {
+			p.editInstruction(f, MKInstruction(MVF, next-f-1))
+		}
+	}
+	if e = coverage.check(); e != nil {
+		return ErrorAt(block.Tokens[0].Pos, e)
+	}
+	end := p.fragmentSize()
+	for _, j := range ends {
+		p.editInstruction(j, MKInstruction(MVR, end-j-1))
+	}
+	if e = p.closeScope(); e != nil {
+		return e
+	}
+	if exhaustive && returns {
+		*p.currentScope().returnLnFlag = returnLnFlag{true, true}
+	}
+	return nil
+}
+
+//Not a keyword, receive is also the function that reads channels
+func isReceiveBlock(tks []Token) bool {
+	return len(tks) == 2 && tks[0].Kind == IdToken && tks[0].Data == "receive" && tks[1].Is(DO)
+}
+
+//Takes the first message of the mailbox matching an arm, waiting for it if there is none
+func (p *Parser) parseReceive(block Block, scp ScopeCtx) error {
+	if len(block.Children) == 0 {
+		return errors.New("Expecting receive arms")
+	}
+	p.openScope()
+	index := p.currentScope().CreateHiddenVariable("mailbox", Int)
+	message := p.currentScope().CreateHiddenVariable("message", Any)
+	p.addInstructions([]Instruction{MKInstruction(PSH, 0), MKInstruction(SLI, index)})
+	loop := p.fragmentSize()
+	p.addInstructions([]Instruction{MKInstruction(LLI, index), MKInstruction(MBP), MKInstruction(SLI, message)})
+	load := []Instruction{MKInstruction(LLI, message)}
+	ends := make([]int, 0)
+	for i, arm := range block.Children {
+		head, r := readUntilToken(arm.Tokens, DO)
+		if e := expectBlockOpening(r); e != nil {
+			return ErrorAt(arm.Tokens[0].Pos, e)
+		}
+		pt, e := parsePattern(head)
+		if e != nil {
+			return ErrorAt(arm.Tokens[0].Pos, e)
+		}
+		fails := make([]int, 0)
+		if e = p.testPattern(pt, Any, load, &fails); e != nil {
+			return e
+		}
+		if len(fails) == 0 && i < len(block.Children)-1 {
+			return ErrorAt(block.Children[i+1].Tokens[0].Pos, errors.New("Unreachable receive arm"))
+		}
+		p.addInstructions([]Instruction{MKInstruction(LLI, index), MKInstruction(MBT)})
+		p.openScope()
+		if e = p.bindPattern(pt, Any, load); e != nil {
+			return e
+		}
+		if e = p.parseBlocks(arm.Children, scp); e != nil {
+			return e
+		}
+		if e = p.closeScope(); e != nil {
+			return e
+		}
+		ends = append(ends, p.addInstruction(MKInstruction(MVR)))
+		next := p.fragmentSize()
+		for _, f := range fails {
+			p.editInstruction(f, MKInstruction(MVF, next-f-1))
+		}
+	}
+	//No arm matched, the next message is tried
+	p.addInstructions([]Instruction{MKInstruction(LLI, index), MKInstruction(ADD, nil, 1), MKInstruction(SLI, index)})
+	p.addInstruction(MKInstruction(MVR, loop-p.fragmentSize()-1))
+	end := p.fragmentSize()
+	for _, j := range ends {
+		p.editInstruction(j, MKInstruction(MVR, end-j-1))
+	}
+	return p.closeScope()
+}
+
+//Arms receive (x in ch), send (ch <- v) or run if no other is ready (else), the first ready is run
+func (p *Parser) parseSelect(block Block, scp ScopeCtx) error {
+	if e := expectBlockOpening(discardOne(block.Tokens)); e != nil {
+		return e
+	}
+	if len(block.Children) == 0 {
+		return errors.New("Expecting select arms")
+	}
+	sends := make([]bool, 0)
+	names := make([]string, 0)
+	items := make([]OBJType, 0)
+	fallback := false
+	for i, arm := range block.Children {
+		head, r := readUntilToken(arm.Tokens, DO)
+		if e := expectBlockOpening(r); e != nil {
+			return ErrorAt(arm.Tokens[0].Pos, e)
+		}
+		if next(head, ELSE) {
+			if e := unexpect(discardOne(head)); e != nil {
+				return e
+			}
+			if i < len(block.Children)-1 {
+				return ErrorAt(head[0].Pos, errors.New("Else must be the last select arm"))
+			}
+			fallback = true
+			break
+		}
+		left, right := readUntilToken(head, IN)
+		send := len(right) == 0
+		if send {
+			if left, right = readUntilToken(head, SENDOP); len(right) == 0 {
+				return ErrorAt(arm.Tokens[0].Pos, errors.New("Expecting a receive (x in ch), a send (ch <- v) or else"))
+			}
+		}
+		channel := left
+		if !send {
+			id, tail, e := expectT(left, IdToken)
+			if e != nil {
+				return ErrorAt(arm.Tokens[0].Pos, e)
+			}
+			if e = unexpect(tail); e != nil {
+				return e
+			}
+			names = append(names, id.Data)
+			channel = discardOne(right)
+		} else {
+			names = append(names, "_")
+		}
+		tp, e := p.parseExpression(channel, nil, false)
+		if e != nil {
+			return e
+		}
+		if tp.Primitive() != CHANNEL {
+			return ErrorAt(channel[0].Pos, fmt.Errorf("Expecting channel, found %s", Repr(tp)))
+		}
+		if send {
+			vt, e := p.parseExpression(discardOne(right), nil, false)
+			if e != nil {
+				return e
+			}
+			if !CompareTypes(tp.Items(), vt) {
+				return ErrorAt(right[0].Pos, fmt.Errorf("Can not send %s through %s", Repr(vt), Repr(tp)))
+			}
+		}
+		sends = append(sends, send)
+		items = append(items, tp.Items())
+	}
+	fb := 0
+	if fallback {
+		fb = 1
+	}
+	p.openScope()
+	index := p.currentScope().CreateHiddenVariable("select", Int)
+	value := p.currentScope().CreateHiddenVariable("received", Any)
+	p.addInstructions([]Instruction{MKInstruction(SEL, sends, fb), MKInstruction(SLI, index), MKInstruction(SLI, value)})
+	ends := make([]int, 0)
+	for i, arm := range block.Children {
+		p.addInstructions([]Instruction{MKInstruction(LLI, index), MKInstruction(PSH, i), MKInstruction(EQV)})
+		skip := p.addInstruction(MKInstruction(MVF))
+		p.openScope()
+		if i < len(names) && !sends[i] && names[i] != "_" {
+			tp := OptOf(items[i])
+			p.currentScope().CreateVariable(names[i], tp, false, false)
+			set, e := p.currentScope().SetVariableIns(names[i], tp)
+			if e != nil {
+				return e
+			}
+			p.addInstructions([]Instruction{MKInstruction(LLI, value), set})
+		}
+		if e := p.parseBlocks(arm.Children, scp); e != nil {
+			return e
+		}
+		if e := p.closeScope(); e != nil {
+			return e
+		}
+		ends = append(ends, p.addInstruction(MKInstruction(MVR)))
+		p.editInstruction(skip, MKInstruction(MVF, p.fragmentSize()-skip-1))
+	}
+	end := p.fragmentSize()
+	for _, j := range ends {
+		p.editInstruction(j, MKInstruction(MVR, end-j-1))
+	}
+	return p.closeScope()
+}
+
 func (p *Parser) parseByKeyword(name string, block Block, scp ScopeCtx) error {
 	if scp == Global {
 		switch name {
@@ -827,6 +1405,10 @@ func (p *Parser) parseByKeyword(name string, block Block, scp ScopeCtx) error {
 			return p.parseAlias(block)
 		case "struct":
 			return p.parseStruct(block)
+		case "enum":
+			return p.parseEnum(block)
+		case "interface":
+			return p.parseInterface(block)
 		}
 	}
 	if scp == Function || scp == Loop {
@@ -839,6 +1421,10 @@ func (p *Parser) parseByKeyword(name string, block Block, scp ScopeCtx) error {
 			return p.parseIf(block.Tokens, block.Children, scp)
 		case "while":
 			return p.parseWhile(block)
+		case "match":
+			return p.parseMatch(block, scp)
+		case "select":
+			return p.parseSelect(block, scp)
 		case "else":
 			return p.parseElse(block, scp)
 		case "for":
@@ -855,7 +1441,9 @@ func (p *Parser) parseByKeyword(name string, block Block, scp ScopeCtx) error {
 		case "throw":
 			return p.parseThrow(block)
 		case "rescue":
-			return p.parseRescue(block)
+			return p.parseRescue(block, scp)
+		case "ensure":
+			return p.parseEnsure(block, scp)
 		}
 	}
 	if scp == Loop {
@@ -875,32 +1463,6 @@ func (p *Parser) parseByKeyword(name string, block Block, scp ScopeCtx) error {
 	return fmt.Errorf("Unexpected keyword found: %s", name)
 }
 
-func (p *Parser) parseById(block Block, scp ScopeCtx) error {
-	tks, e := splitByToken(block.Tokens, func(tk Token) bool { return tk == ASSIGN }, make([]struct {
-		open  Token
-		close Token
-	}, 0), false, false, false)
-	if e != nil {
-		return e
-	}
-	if len(tks) > 2 {
-		return errors.New("Multiassignment is not implemented")
-	}
-	t, e := p.parseExpression(tks[len(tks)-1], block.Children, false)
-	if e != nil {
-		return e
-	}
-	if len(tks) == 2 {
-		if t == Void {
-			return errors.New("No value returned")
-		}
-		//return p.parseAssignment(tks[0])
-	} else if t != Void {
-		p.addInstruction(MKInstruction(POP))
-	}
-	return nil
-}
-
 func (p *Parser) parseBlock(block Block, scp ScopeCtx) error {
 	ifFlags := p.currentScope().ifFlags
 	ifFlags.altered = false
@@ -910,8 +1472,11 @@ func (p *Parser) parseBlock(block Block, scp ScopeCtx) error {
 	if len(block.Tokens) == 0 {
 		panic("Void block")
 	}
+	defer p.locate(block.Tokens[0].Pos)()
 	if nextT(block.Tokens, KeywordToken) {
 		err = p.parseByKeyword(block.Tokens[0].Data, block, scp)
+	} else if (scp == Function || scp == Loop) && isReceiveBlock(block.Tokens) {
+		err = p.parseReceive(block, scp)
 	} else if scp == Function || scp == Loop {
 		var ret OBJType
 		ret, err = p.parseExpression(block.Tokens, block.Children, false)
@@ -930,15 +1495,47 @@ func (p *Parser) parseBlock(block Block, scp ScopeCtx) error {
 	return err
 }
 
+//Once the else blocks after an if are over, a chain of if val without else must handle every variant
+func (p *Parser) closeIfChain() error {
+	flags := p.currentScope().ifFlags
+	chain := flags.chain
+	flags.chain = nil
+	if chain == nil {
+		return nil
+	}
+	return chain.check()
+}
+
+//Tokens missing at the end are expected right after the first line of the block, where its header is
+func locateMissing(e error, block Block) error {
+	var missing *missingToken
+	if !errors.As(e, &missing) {
+		return e
+	}
+	text := strings.TrimRight(block.Lines[block.Begin], " \t")
+	return ErrorAt(Position{Origin: block.Origin, Line: block.Begin, Column: len([]rune(text)) + 1}, e)
+}
+
 func (p *Parser) parseBlocks(blocks []Block, scp ScopeCtx) error {
-	for _, block := range blocks {
-		if e := p.parseBlock(block, scp); e != nil {
+	guards := p.currentScope().guards
+	for i, block := range blocks {
+		e := p.parseBlock(block, scp)
+		if e == nil && (i+1 == len(blocks) || !next(blocks[i+1].Tokens, ELSE)) {
+			e = p.closeIfChain()
+		}
+		if e != nil {
+			e = locateMissing(e, block)
 			strerr := e.Error()
 			if !strings.ContainsRune(strerr, '\n') {
 				lineid := strconv.Itoa(block.Begin)
 				if block.Begin != block.End {
 					lineid = lineid + ".." + strconv.Itoa(block.End)
 				}
+				var located *SourceError
+				if errors.As(e, &located) && located.Pos.Origin == block.Origin {
+					lineid = fmt.Sprintf("%d:%d", located.Pos.Line, located.Pos.Column)
+					strerr += located.Pos.Excerpt(block.Lines)
+				}
 				file := block.Origin
 				if wdir, err := os.Getwd(); err == nil {
 					if relpath, err := filepath.Rel(wdir, file); err == nil {
@@ -950,5 +1547,5 @@ func (p *Parser) parseBlocks(blocks []Block, scp ScopeCtx) error {
 			return e
 		}
 	}
-	return nil
+	return p.closeGuards(guards)
 }
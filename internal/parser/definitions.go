@@ -25,6 +25,9 @@ var (
 	NOTOP          = Token{Data: "!", Kind: OperatorToken}
 	DOUBLES        = Token{Data: ":", Kind: SpecialToken}
 	SPLITTER       = Token{Data: "|", Kind: OperatorToken}
+	NOARGS         = Token{Data: "||", Kind: OperatorToken}
+	ARROW          = Token{Data: "->", Kind: OperatorToken}
+	SENDOP         = Token{Data: "<-", Kind: OperatorToken}
 	COMA           = Token{Data: ",", Kind: SpecialToken}
 	QUOTE          = Token{Data: "'", Kind: OperatorToken}
 	POPEN          = Token{Data: "(", Kind: SpecialToken}
@@ -35,4 +38,6 @@ var (
 	CBCLOSE        = Token{Data: "}", Kind: SpecialToken}
 	TRUE           = Token{Data: "true", Kind: KeywordToken}
 	FALSE          = Token{Data: "false", Kind: KeywordToken}
+	NONE           = Token{Data: "none", Kind: KeywordToken}
+	ELSE           = Token{Data: "else", Kind: KeywordToken}
 )
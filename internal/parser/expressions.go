@@ -42,7 +42,7 @@ func (p *Parser) parseArguments(tks []Token) (args []string, types []OBJType, us
 			return
 		}
 	}
-	argtk, err := splitByToken(preargs, func(tk Token) bool { return tk == COMA }, genericPairs, false, false, false)
+	argtk, err := splitByToken(preargs, func(tk Token) bool { return tk.Is(COMA) }, genericPairs, false, false, false)
 	for i, v := range argtk {
 		n := v
 		if next(n, QUOTE) {
@@ -50,7 +50,7 @@ func (p *Parser) parseArguments(tks []Token) (args []string, types []OBJType, us
 				varargs = true
 				n = discardOne(n)
 			} else {
-				err = fmt.Errorf("Unexpected token: %s", v[0].Data)
+				err = ErrorAt(v[0].Pos, fmt.Errorf("Unexpected token: %s", v[0].Data))
 				return
 			}
 		}
@@ -9,9 +9,13 @@ import (
 )
 
 type FunctionTemplate struct {
-	Args     []string
-	Varargs  bool
-	Children []lexer.Block
+	Args        []string
+	Varargs     bool
+	Children    []lexer.Block
+	Expression  []lexer.Token //Returned expression when the function has no block
+	Outer       *Scope        //Scope enclosing a nested function, nil for global functions
+	Constraints []OBJType     //Declared argument types when any of them is an interface
+	Pos         lexer.Position
 }
 
 type FunctionSymbol struct {
@@ -58,12 +62,15 @@ func (collection *FunctionCollection) Fork() *FunctionCollection {
 
 func (collection *FunctionCollection) CopyFrom(other *FunctionCollection) error {
 	for k, v := range other.templates {
-		if v.variadic != nil {
+		if v.variadic != nil && !collection.containsTemplate(k, *v.variadic) {
 			if e := collection.AddTemplate(k, *v.variadic); e != nil { //Copy variadic template
 				return e
 			}
 		}
 		for _, t := range v.fixedargs { //Copy fixed length template
+			if collection.containsTemplate(k, t) { //Already reached through another import
+				continue
+			}
 			if e := collection.AddTemplate(k, t); e != nil {
 				return e
 			}
@@ -84,6 +91,24 @@ func (collection *FunctionCollection) CopyFrom(other *FunctionCollection) error
 	return nil
 }
 
+//Templates are the same when they share the source block
+func (collection *FunctionCollection) containsTemplate(name string, template FunctionTemplate) bool {
+	v, e := collection.templates[name]
+	if !e || len(template.Children) == 0 {
+		return false
+	}
+	var t FunctionTemplate
+	if template.Varargs {
+		if v.variadic == nil {
+			return false
+		}
+		t = *v.variadic
+	} else if t, e = v.fixedargs[len(template.Args)]; !e {
+		return false
+	}
+	return len(t.Children) > 0 && &t.Children[0] == &template.Children[0]
+}
+
 func (collection *FunctionCollection) AddTemplate(name string, template FunctionTemplate) error {
 	v, e := collection.templates[name]
 	if !e {
@@ -17,6 +17,8 @@ type Parser struct {
 	}
 	symbols       map[string]*Symbol
 	fragmenttrack []string
+	closures      map[string]*closureInfo
+	position      Position //Source of the instructions being added
 }
 
 type ImportEnv interface {
@@ -36,9 +38,11 @@ func NewParser(name string, envId int, env ImportEnv) *Parser {
 	p := &Parser{env, envId, NewScope(name), make(map[string]struct {
 		origin  *Scope
 		current *Scope
-	}), make(map[string]*Symbol), make([]string, 0)}
+	}), make(map[string]*Symbol), make([]string, 0), make(map[string]*closureInfo), Position{}}
 	injectBuiltinFunctions(p.rootscope.Functions)
+	injectSyncFunctions(p.rootscope.Functions)
 	injectBuiltinOperators(p.rootscope.Operators)
+	injectBuiltinFixities(p.rootscope.Fixities)
 	injectBuiltinTypes(p.rootscope.DefinedTypes)
 	return p
 }
@@ -54,7 +58,23 @@ func (p *Parser) activeFragment() string {
 	return p.fragmenttrack[len(p.fragmenttrack)-1]
 }
 
+//Instructions added from now on come from the position
+func (p *Parser) locate(pos Position) (restore func()) {
+	previous := p.position
+	p.position = pos
+	return func() {
+		p.position = previous
+	}
+}
+
+func (p *Parser) markPosition(s *Symbol) {
+	if p.position.Known() {
+		s.Lines.Mark(len(s.Source), p.position.Origin, p.position.Line, p.position.Column)
+	}
+}
+
 func (p *Parser) addInstruction(instruction Instruction) int {
+	p.markPosition(p.symbols[p.activeFragment()])
 	p.symbols[p.activeFragment()].Append(instruction)
 	return len(p.symbols[p.activeFragment()].Source) - 1
 }
@@ -72,6 +92,9 @@ func (p *Parser) editInstruction(pos int, instruction Instruction) {
 
 func (p *Parser) addInstructions(instructions []Instruction) int {
 	s := p.symbols[p.activeFragment()]
+	if len(instructions) > 0 {
+		p.markPosition(s)
+	}
 	for _, i := range instructions {
 		s.Append(i)
 	}
@@ -0,0 +1,972 @@
+package parser_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+type programCase struct {
+	name string
+	src  string
+	want string
+}
+
+func runCases(t *testing.T, cases []programCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			out, err := bsttest.Run(t, c.src, nil)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if want := bsttest.Source(c.want); out != want {
+				t.Fatalf("Got:\n%s\nExpecting:\n%s", out, want)
+			}
+		})
+	}
+}
+
+type errorCase struct {
+	name    string
+	src     string
+	message string
+	line    int
+	column  int
+}
+
+func runErrorCases(t *testing.T, cases []errorCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, _, err := bsttest.Compile(t, c.src)
+			if err == nil {
+				t.Fatalf("Expecting %q", c.message)
+			}
+			if !strings.Contains(err.Error(), c.message) {
+				t.Fatalf("Expecting %q, got %q", c.message, err.Error())
+			}
+			//Errors of a whole line have no column
+			at := fmt.Sprintf("[Error in line (%d:%d)]", c.line, c.column)
+			if c.column == 0 {
+				at = fmt.Sprintf("[Error in line (%d)]", c.line)
+			}
+			if !strings.Contains(err.Error(), at) {
+				t.Fatalf("Expecting the error at %s, got %q", at, err.Error())
+			}
+		})
+	}
+}
+
+//Compilation errors point at the expression that caused them
+func TestErrorPositions(t *testing.T) {
+	runErrorCases(t, []errorCase{
+		{"operator mismatch", `
+			import "../std"
+
+			fn main do
+			    val x = 10
+			    print: x + "a"
+		`, "There is no operator template +/2 valid for (Int,Str)", 5, 14},
+		{"nested undefined variable", `
+			import "../std"
+
+			fn main do
+			    val x = 10
+			    print: 2 * (x - missing)
+		`, "Undefined variable: missing", 5, 21},
+	})
+}
+
+func TestOperators(t *testing.T) {
+	runCases(t, []programCase{
+		{"precedence", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    print: 10 - 3 - 2
+			    print: 2 * 3 + 4
+			    print: 2 + 3 * 4
+			    print: 2 ** 3 ** 2
+			    print: -2 * 3 + 1
+			    print: 1 + 2 == 3 && 2 < 3
+			    print: 100 / 10 / 5
+			    print: 1 << 2 + 1
+		`, `
+			5
+			10
+			14
+			512
+			-5
+			1
+			2
+			5
+		`},
+		{"short circuit", `
+			import "../std"
+
+			fn boom: x do
+			    throw "evaluated"
+			    return x
+
+			fn main: args Vec|Str do
+			    val v = [Vec|Int]
+			    print: len(v) > 0 && v[0] == 1
+			    print: len(v) == 0 || v[0] == 1
+			    print: false || true && true
+			    print: (1 == 1 && 2 == 2) || boom(false)
+			    print: false ^^ true
+		`, `
+			0
+			1
+			1
+			1
+			1
+		`},
+		{"user fixity", `
+			import "../std"
+
+			op <+> infixr 4
+
+			op <+>: a Int, b Int do
+			    return a - b
+
+			fn main: args Vec|Str do
+			    print: 10 <+> 4 <+> 1
+			    print: 1 + 2 <+> 1
+		`, `
+			7
+			2
+		`},
+	})
+}
+
+func TestFixityErrors(t *testing.T) {
+	runErrorCases(t, []errorCase{
+		{"redefined precedence", `
+			import "../std"
+			op ** infixl 3
+			fn main: args Vec|Str do
+			    print: 1
+		`, "Operator ** already has a different precedence", 2, 4},
+	})
+}
+
+//Continue goes back to the condition of the loop, break leaves it
+func TestLoops(t *testing.T) {
+	runCases(t, []programCase{
+		{"while", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    var i = 0
+			    var odd = 0
+			    while i < 6 do
+			        i = i + 1
+			        if i % 2 == 0 do
+			            continue
+			        odd = odd + i
+			    print: i, " ", odd
+			    var j = 0
+			    while j < 3 && odd > 0 do
+			        j = j + 1
+			        var k = 0
+			        while true do
+			            k = k + 1
+			            if k < j do
+			                continue
+			            break
+			        print: j, k
+		`, `
+			6 9
+			11
+			22
+			33
+		`},
+	})
+}
+
+//Tokens missing at the end of a line are pointed right after it
+func TestTokenErrors(t *testing.T) {
+	runErrorCases(t, []errorCase{
+		{"if without do", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    if 1 > 0
+			    print: 1
+		`, "Expecting token: do", 4, 13},
+		{"rescue without do", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    rescue e Str
+			        print: e
+			    print: 1
+		`, "Expecting token: do", 4, 17},
+		{"while over Int", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    while 3 do
+			        print: 1
+		`, "Expecting boolean expression", 4, 11},
+		{"for without in", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    for i {0, 2}Range do
+			        print: i
+		`, "Expecting 'in' keyword", 4, 5},
+		{"reference without arguments", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    val f = fn main
+		`, "Expecting token ':'", 4, 13},
+	})
+}
+
+func TestPatterns(t *testing.T) {
+	runCases(t, []programCase{
+		{"destructuring", `
+			import "../std"
+
+			struct Point: x Int, y Int
+
+			fn pair: a, b do
+			    return a, b
+
+			fn main: args Vec|Str do
+			    val a, b = pair(1, "two")
+			    print: a
+			    print: b
+			    var x, y = 3, 4
+			    x, y = y, x
+			    print: x
+			    print: y
+			    val {p, {q, _}} = {1, {2, 3}}
+			    print: p + q
+			    val pt = {10, 20}Point
+			    val {x: px, y: py} = pt
+			    print: px * py
+			    val {u, v} = pt
+			    print: u - v
+			    {x, _} = {7, 8}
+			    print: x
+		`, `
+			1
+			two
+			4
+			3
+			3
+			200
+			-10
+			7
+		`},
+		{"match", `
+			import "../std"
+
+			struct Point: x Int, y Int
+
+			fn describe: r {Atom, Int} do
+			    match r do
+			        {:ok, 0} do
+			            print: "ok zero"
+			        {:ok, v} do
+			            print: v
+			        {:error, _} do
+			            print: "error"
+			        _ do
+			            print: "other"
+
+			fn number: n Int do
+			    match n do
+			        -1 do
+			            print: "minus one"
+			        k do
+			            print: k * 10
+
+			fn point: p Point do
+			    match p do
+			        {x: 0, y: y}Point do
+			            print: y
+			        {a, b} do
+			            print: a + b
+
+			fn anything: a Any do
+			    match a do
+			        "hi" do
+			            print: "string hi"
+			        {_, _} do
+			            print: "pair"
+			        _ do
+			            print: "something else"
+
+			fn main: args Vec|Str do
+			    describe: {:ok, 0}
+			    describe: {:ok, 5}
+			    describe: {:error, 1}
+			    describe: {:other, 1}
+			    number: -1
+			    number: 4
+			    point: {0, 9}Point
+			    point: {3, 4}Point
+			    anything: "hi"
+			    anything: {1, 2}
+			    anything: 3
+			    for i in indexer(vec(1, 2, 3)) do
+			        match i.value do
+			            1 do
+			                continue
+			            _ do
+			                print: i.value
+		`, `
+			ok zero
+			5
+			error
+			other
+			minus one
+			40
+			9
+			7
+			string hi
+			pair
+			something else
+			0
+			2
+		`},
+		{"optionals", `
+			import "../std"
+
+			fn half: n Int do
+			    if n % 2 == 0 do
+			        return some: n / 2
+			    return none
+
+			fn main: args Vec|Str do
+			    val m = [Map|Int]
+			    m["a"] = 3
+			    if val y = m["b"] do
+			        print: y
+			    else do
+			        print: "no b"
+			    print: unwrap_or(m["b"], 42)
+			    match half: 7 do
+			        none do
+			            print: "odd"
+			        some v do
+			            print: v
+			    if val some 5 = half: 10 do
+			        print: "five"
+		`, `
+			no b
+			42
+			odd
+			five
+		`},
+	})
+}
+
+func TestPatternErrors(t *testing.T) {
+	runErrorCases(t, []errorCase{
+		{"not destructurable", `
+			import "../std"
+			fn main: args Vec|Str do
+			    val a, b = 1
+		`, "Type Int can not be destructured", 3, 9},
+		{"pattern type", `
+			import "../std"
+			fn main: args Vec|Str do
+			    match 3 do
+			        "a" do
+			            print: 1
+		`, "Pattern of type Str can not match Int", 4, 9},
+		{"unchecked type over Any", `
+			import "../std"
+			struct Point: x Int, y Int
+			fn main: args Vec|Str do
+			    receive do
+			        {p}Point do
+			            print: p
+		`, "Type Point can not be checked over Any", 5, 12},
+		{"checked type assigned", `
+			import "../std"
+			fn show: a Any do
+			    val (n)Int = a
+		`, "Only patterns that always match can assign values", 3, 12},
+		{"non exhaustive", `
+			import "../std"
+
+			enum Shape: Circle {Dec}, Rect {Dec, Dec}, Empty
+
+			fn main: args Vec|Str do
+			    match Circle(2.0) do
+			        Circle {r} do
+			            print: r
+			        Rect {1.0, _} do
+			            print: "thin"
+		`, "Non-exhaustive handling of Shape, missing variants: Rect, Empty", 6, 5},
+		{"non exhaustive if val chain", `
+			import "../std"
+
+			enum Shape: Circle {Dec}, Rect {Dec, Dec}, Empty
+
+			fn main: args Vec|Str do
+			    val sh = Rect: 1.5, 2.0
+			    if val Circle {r} = sh do
+			        print: r
+			    else if val Rect {a, _} = sh do
+			        print: a
+			    print: "after"
+		`, "Non-exhaustive handling of Shape, missing variants: Empty", 7, 5},
+		{"map of optionals", `
+			import "../std"
+			fn main: args Vec|Str do
+			    val m = [Map|Opt|Int]
+		`, "Map of an optional is not allowed", 3, 13},
+		{"channel of optionals", `
+			import "../std"
+			fn main: args Vec|Str do
+			    val c = [Chan|Opt|Int]
+		`, "Channel of an optional is not allowed", 3, 13},
+		{"generic optional of an optional", `
+			import "../std"
+			struct Maybe|T: value Opt|T
+			fn show: m Maybe|Opt|Int do
+			    print: m.value
+		`, "Optional of an optional is not allowed", 3, 0},
+		{"match not exhaustive without return", `
+			import "../std"
+			fn name: n Int do
+			    match n do
+			        0 do
+			            return "zero"
+			        1 do
+			            return "one"
+		`, "Expecting return of type: Str", 2, 0},
+		{"match arm without return", `
+			import "../std"
+			fn name: n Int do
+			    match n do
+			        0 do
+			            return "zero"
+			        k do
+			            print: k
+		`, "Expecting return of type: Str", 2, 0},
+	})
+}
+
+func TestEnums(t *testing.T) {
+	runCases(t, []programCase{
+		{"variants", `
+			import "../std"
+
+			enum Shape: Circle {Dec}, Rect {Dec, Dec}, Empty
+
+			enum Wrap: Only {Int, Str}
+
+			fn main: args Vec|Str do
+			    val sh = Rect: 1.5, 2.0
+			    if val Circle {r} = sh do
+			        print: r
+			    else if val Rect {a, _} = sh do
+			        print: a
+			    else do
+			        print: "none"
+			    val Only {n, name} = Only(3, "three")
+			    print: n
+			    print: name
+			    print: sh
+		`, `
+			1.5
+			3
+			three
+			&[Rect 1.5 2]
+		`},
+		{"if val chains", `
+			import "../std"
+
+			enum Shape: Circle {Dec}, Rect {Dec, Dec}, Empty
+
+			fn name: sh Shape do
+			    if val Circle {_} = sh do
+			        return "circle"
+			    else if val Rect {_, _} = sh do
+			        return "rect"
+			    else if val Empty = sh do
+			        return "empty"
+			    return "none"
+
+			fn main: args Vec|Str do
+			    val sh = Rect: 1.5, 2.0
+			    val other = Circle: 1.0
+			    if val Rect {a, _} = sh do
+			        print: a
+			    if val Circle {r} = sh do
+			        print: r
+			    else if val Circle {r} = other do
+			        print: r
+			    if val Circle {r} = sh do
+			        print: r
+			    else if val Rect {1.0, _} = sh do
+			        print: "thin"
+			    else do
+			        print: "other"
+			    print: name(sh)
+		`, `
+			1.5
+			1
+			other
+			rect
+		`},
+		{"returning match", `
+			import "../std"
+
+			enum Shape: Circle {Dec}, Rect {Dec, Dec}, Empty
+
+			fn area: s Shape do
+			    match s do
+			        Circle {r} do
+			            return r * r * 3.0
+			        Rect {w, h} do
+			            return w * h
+			        Empty do
+			            return 0.0
+
+			fn sign: n Int do
+			    match n do
+			        0 do
+			            return "zero"
+			        k do
+			            if k < 0 do
+			                return "negative"
+			            return "positive"
+
+			fn main: args Vec|Str do
+			    print: area(Circle(1.0))
+			    print: area(Rect(2.0, 3.0))
+			    print: area(Empty())
+			    print: sign(0), " ", sign(-3), " ", sign(4)
+		`, `
+			3
+			6
+			0
+			zero negative positive
+		`},
+	})
+}
+
+func TestFunctions(t *testing.T) {
+	runCases(t, []programCase{
+		{"closures", `
+			import "../std"
+
+			fn apply: f, x do
+			    return callfn: f, x
+
+			fn make_adder: n Int do
+			    fn add: x Int do
+			        return x + n
+			    return add: 1
+
+			fn outer: a Int, b Int do
+			    val c = a * b
+			    fn mid: x Int do
+			        fn inner: y Int do
+			            return y + c + a
+			        return inner: x
+			    fn fact: k Int do
+			        if k <= 1 do
+			            return a
+			        return k * fact(k - 1)
+			    print: "mid ", mid(10)
+			    print: "fact ", fact(4)
+			    val r = fn mid: {Int}
+			    print: "ref ", apply(r, 5)
+
+			fn main: args Vec|Str do
+			    print: make_adder(41)
+			    outer: 2, 3
+		`, `
+			42
+			mid 18
+			fact 48
+			ref 13
+		`},
+		{"lambdas", `
+			import "../std"
+
+			fn twice: f, x do
+			    return f(f(x))
+
+			fn main: args Vec|Str do
+			    val k = 10
+			    val inc = |x Int| x + k
+			    print: callfn(inc, 1)
+			    val add = fn: a Int, b Int do
+			        val s = a + b
+			        return s * k
+			    print: callfn(add, 2, 3)
+			    print: twice(inc, 5)
+			    print: twice((|s Int| s * 3), 2)
+			    val hello = || "hello"
+			    print: callfn(hello)
+			    print: callmapfn(add, {4, 5})
+		`, `
+			11
+			50
+			25
+			18
+			hello
+			90
+		`},
+		{"inferred lambdas", `
+			import "../std"
+
+			fn apply: f {Int}|Int, x Int do
+			    return callfn: f, x
+
+			fn both: f {Int, Str}|Str, x Int do
+			    return callfn: f, x, "s"
+
+			fn main: args Vec|Str do
+			    val k = 5
+			    print: apply(|x| x + k, 1)
+			    print: apply((|x| x * 10), 3)
+			    print: both((|n, s| s), 1)
+		`, `
+			6
+			30
+			s
+		`},
+		{"captured copies", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    var n = 1
+			    val f = |x Int| x + n
+			    fn g: x Int do
+			        return x + n
+			    n = 2
+			    print: callfn(f, 0), " ", g(0)
+			    val seen = [Vec|Int]
+			    val keep = fn: x Int do
+			        x -> seen
+			    callfn: keep, 4
+			    callfn: keep, 5
+			    print: seen
+		`, `
+			1 2
+			&[4 5]
+		`},
+		{"iterators", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    val v = [Vec|Int]
+			    for i in {0, 4}Range do
+			        i.value -> v
+			    val lim = 1
+			    print: filter(v, (|x Int| x > lim))
+			    print: map(v, (|x Int| x * 10))
+			    print: map(v, |x| x + 1)
+			    print: filter(v, |x| x > lim)
+			    each: v, fn: x Int do
+			        print: "item ", x
+			    each: v, fn: x do
+			        print: "untyped ", x
+		`, `
+			&[2 3]
+			&[0 10 20 30]
+			&[1 2 3 4]
+			&[2 3]
+			item 0
+			item 1
+			item 2
+			item 3
+			untyped 0
+			untyped 1
+			untyped 2
+			untyped 3
+		`},
+		{"generics", `
+			import "../std"
+
+			struct Pair|A|B:
+			    first A,
+			    second B
+
+			fn swap: p do
+			    return {p.second, p.first}Pair
+
+			fn show: p Pair|Int|Any do
+			    print: "left ", p.first
+
+			fn main: args Vec|Str do
+			    val p = {1, "one"}Pair
+			    print: p.second, " ", p.first + 1
+			    val q = swap: p
+			    print: q.first, " ", q.second
+			    show: p
+			    match q do
+			        {s, n}Pair do
+			            print: "matched ", s, n
+		`, `
+			one 2
+			one 1
+			left 1
+			matched one1
+		`},
+		{"interfaces", `
+			import "../std"
+
+			interface Shape:
+			    fn area: Self -> Int,
+			    op ==: Self, Self -> Bool
+
+			struct Square:
+			    side Int
+
+			fn area: s Square do
+			    return s.side * s.side
+
+			op ==: a Square, b Square do
+			    return a.side == b.side
+
+			fn total: a Shape, b Shape do
+			    return area(a) + area(b)
+
+			fn main: args Vec|Str do
+			    print: count({0, 5}Range)
+			    print: total({2}Square, {3}Square)
+		`, `
+			5
+			13
+		`},
+	})
+	runErrorCases(t, []errorCase{
+		{"lambda with nothing to infer", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    val f = |x| x
+		`, "Lambda arguments must be typed when their types can not be inferred", 4, 13},
+		{"lambda passed to untyped parameter without a vector", `
+			import "../std"
+
+			fn apply: f, x do
+			    return callfn: f, x
+
+			fn main: args Vec|Str do
+			    print: apply(|x| x, 1)
+		`, "Lambda arguments must be typed when their types can not be inferred", 7, 18},
+		{"assigning a captured variable", `
+			import "../std"
+
+			fn main: args Vec|Str do
+			    var n = 1
+			    fn bump do
+			        n = n + 1
+			    bump:
+		`, "Captured variable can not be assigned: n", 6, 13},
+	})
+}
+
+func TestExceptions(t *testing.T) {
+	runCases(t, []programCase{
+		{"typed rescue", `
+			import "../std"
+
+			struct NotFound: key Str
+			struct Invalid: code Int
+
+			fn lookup: k Int do
+			    if k == 1 do
+			        throw {"key"}NotFound
+			    if k == 2 do
+			        throw {7}Invalid
+			    if k == 3 do
+			        throw "plain"
+			    return 1
+
+			fn inner: k Int do
+			    rescue e NotFound do
+			        print: "not found: ", e.key
+			        return 0
+			    return lookup: k
+
+			fn outer: k Int do
+			    rescue e Invalid do
+			        print: "invalid: ", e.code
+			        return -1
+			    return inner: k
+
+			fn catchall: k Int do
+			    rescue e do
+			        print: "message: ", e
+			        return -2
+			    return outer: k
+
+			fn main: args Vec|Str do
+			    print: catchall(1)
+			    print: catchall(2)
+			    print: catchall(3)
+			    print: catchall(4)
+		`, `
+			not found: key
+			0
+			invalid: 7
+			-1
+			message: plain
+			-2
+			1
+		`},
+		{"rescue and ensure", `
+			import "../std"
+
+			struct Oops: n Int
+
+			fn risky: n Int do
+			    if n > 2 do
+			        throw {n}Oops
+			    return n
+
+			fn regions: n Int do
+			    var total = 0
+			    do
+			        rescue e Oops do
+			            print: "first region rescued ", e.n
+			        total = total + risky(n)
+			    do
+			        rescue e Oops do
+			            print: "second region rescued ", e.n
+			            total = total + 100
+			        total = total + risky(n + 1)
+			    return total
+
+			fn cleanup: n Int do
+			    ensure do
+			        print: "cleanup ", n
+			    if n == 0 do
+			        return 10
+			    return risky: n
+
+			fn loops do
+			    var i = 0
+			    while i < 4 do
+			        i = i + 1
+			        ensure do
+			            print: "leaving iteration ", i
+			        if i == 2 do
+			            continue
+			        if i == 3 do
+			            break
+			        print: "body ", i
+			    return i
+
+			fn nested do
+			    rescue e Oops do
+			        print: "outer got ", e.n
+			        return -1
+			    do
+			        ensure do
+			            print: "inner ensure"
+			        rescue e Str do
+			            print: "never"
+			        risky: 9
+			    return 0
+
+			fn main: args Vec|Str do
+			    print: regions(2)
+			    print: regions(3)
+			    print: cleanup(0)
+			    rescue e Oops do
+			        print: "main rescued ", e.n
+			    print: loops()
+			    print: nested()
+			    print: cleanup(5)
+			    print: "not reached"
+		`, `
+			second region rescued 3
+			102
+			first region rescued 3
+			second region rescued 4
+			100
+			cleanup 0
+			10
+			body 1
+			leaving iteration 1
+			leaving iteration 2
+			leaving iteration 3
+			3
+			inner ensure
+			outer got 9
+			-1
+			cleanup 5
+			main rescued 5
+		`},
+	})
+}
+
+func TestUncaughtException(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn main: args Vec|Str do
+		    val m = [Map|Int]
+		    print: unwrap(m["zz"])
+	`
+	_, err := bsttest.Run(t, src, nil)
+	var failure *runtime.ProcessError
+	if !errors.As(err, &failure) || failure.Exception.Type != "RuntimeError" {
+		t.Fatalf("Expecting a RuntimeError, got %v", err)
+	}
+}
+
+//Types with the same name from different modules are different errors
+func TestRescueByModule(t *testing.T) {
+	file := bsttest.Write(t, `
+		import "../std"
+		import "other.bst" other
+
+		struct Oops: reason Str
+
+		fn check: n Int do
+		    rescue e Oops do
+		        print: "local oops ", e.reason
+		    if n > 0 do
+		        other.fail: n
+		    throw {"mine"}Oops
+
+		fn main: args Vec|Str do
+		    check: 0
+		    do
+		        rescue e do
+		            print: "not local: ", e
+		        check: 2
+		    rescue e other.Oops do
+		        print: "other oops ", e.code
+		    check: 3
+	`)
+	bsttest.WriteNext(t, file, "other.bst", `
+		struct Oops: code Int
+
+		fn fail: n Int do
+		    throw {n}Oops
+	`)
+	out, err := bsttest.RunFile(t, file, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := bsttest.Source(`
+		local oops mine
+		not local: ` + filepath.Join(filepath.Dir(file), "other.bst") + `.Oops &[2]
+		other oops 3
+	`); out != want {
+		t.Fatalf("Got:\n%s\nExpecting:\n%s", out, want)
+	}
+}
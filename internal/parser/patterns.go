@@ -0,0 +1,665 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+
+	. "github.com/besten/internal/lexer"
+	. "github.com/besten/internal/runtime"
+)
+
+//Describes the shape of a value in order to bind its parts
+type pattern interface {
+	position() Position
+}
+
+type bindPattern struct {
+	name string
+	syntaxPos
+}
+
+type wildcardPattern struct {
+	syntaxPos
+}
+
+//Positional items of a tuple or structure
+type tuplePattern struct {
+	elements []pattern
+	syntaxPos
+}
+
+//Fields of a structure by name
+type namedPattern struct {
+	fields   []string
+	elements []pattern
+	syntaxPos
+}
+
+//Literal or atom the value must be equal to
+type valuePattern struct {
+	value syntaxBranch
+	syntaxPos
+}
+
+//Pattern preceded by the type the value must have: {x: 0, y: y}Point
+type typedPattern struct {
+	inner    pattern
+	typeName []string
+	syntaxPos
+}
+
+//Variant of an enum, without fields only the tag is checked: Circle {r}
+type variantPattern struct {
+	name   string
+	fields *tuplePattern
+	syntaxPos
+}
+
+//Value of an optional that is not none: some x
+type somePattern struct {
+	inner pattern
+	syntaxPos
+}
+
+func isPatternList(tks []Token) bool {
+	if next(tks, CBOPEN) {
+		return true
+	}
+	items, err := splitByToken(tks, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
+	return err == nil && len(items) > 1
+}
+
+//The braces of the outer tuple can be omitted: a, b
+func parsePattern(tks []Token) (pattern, error) {
+	if len(tks) == 0 {
+		return nil, errors.New("Expecting pattern")
+	}
+	items, err := splitByToken(tks, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 1 {
+		return parsePatternItem(items[0])
+	}
+	return parseTuplePattern(items, tks[0].Pos)
+}
+
+func parsePatternItem(tks []Token) (pattern, error) {
+	if len(tks) == 0 {
+		return nil, errors.New("Expecting pattern")
+	}
+	pos := syntaxPos{tks[0].Pos}
+	if len(tks) == 1 && tks[0].Kind == IdToken {
+		if tks[0].Data == "_" {
+			return &wildcardPattern{pos}, nil
+		}
+		return &bindPattern{tks[0].Data, pos}, nil
+	}
+	if len(tks) == 1 && isLiteral(tks[0]) {
+		return &valuePattern{&syntaxLiteral{tks[0].Data, tks[0].Kind, nil, pos}, pos}, nil
+	}
+	if len(tks) == 2 && tks[0].Data == "-" && (tks[1].Kind == IntegerToken || tks[1].Kind == DecimalToken) {
+		return &valuePattern{&syntaxLiteral{"-" + tks[1].Data, tks[1].Kind, nil, pos}, pos}, nil
+	}
+	if len(tks) == 2 && tks[0].Is(DOUBLES) && tks[1].Kind == IdToken {
+		return &valuePattern{&syntaxAtom{tks[1].Data, nil, pos}, pos}, nil
+	}
+	if tks[0].Kind == IdToken && tks[0].Data == "some" && len(tks) > 1 {
+		inner, err := parsePatternItem(tks[1:])
+		if err != nil {
+			return nil, err
+		}
+		return &somePattern{inner, pos}, nil
+	}
+	if tks[0].Kind == IdToken && next(tks[1:], CBOPEN) {
+		fields, err := parsePatternItem(tks[1:])
+		if err != nil {
+			return nil, err
+		}
+		if tuple, ok := fields.(*tuplePattern); ok {
+			return &variantPattern{tks[0].Data, tuple, pos}, nil
+		}
+		return nil, ErrorAt(tks[1].Pos, errors.New("Expecting the variant fields as a tuple"))
+	}
+	if next(tks, CBOPEN) {
+		_, inner, right, err := blockSubtract(tks, CBOPEN, CBCLOSE, genericPairs)
+		if err != nil {
+			return nil, err
+		}
+		items, err := splitByToken(inner, func(t Token) bool { return t.Is(COMA) }, genericPairs, false, false, false)
+		if err != nil {
+			return nil, err
+		}
+		var pt pattern
+		if len(items) > 0 && len(items[0]) > 1 && items[0][0].Kind == IdToken && items[0][1].Is(DOUBLES) {
+			pt, err = parseNamedPattern(items, tks[0].Pos)
+		} else {
+			pt, err = parseTuplePattern(items, tks[0].Pos)
+		}
+		if len(right) == 0 || err != nil {
+			return pt, err
+		}
+		route, err := getRoute(right)
+		if err != nil {
+			return nil, err
+		}
+		return &typedPattern{pt, route, syntaxPos{right[0].Pos}}, nil
+	}
+	//Same as a cast, (x)Int binds x if the value is an Int
+	if next(tks, POPEN) {
+		_, inner, right, err := blockSubtract(tks, POPEN, PCLOSE, genericPairs)
+		if err != nil {
+			return nil, err
+		}
+		if len(inner) == 0 || len(right) == 0 {
+			return nil, ErrorAt(tks[0].Pos, errors.New("Expecting a pattern and its type"))
+		}
+		pt, err := parsePatternItem(inner)
+		if err != nil {
+			return nil, err
+		}
+		route, err := getRoute(right)
+		if err != nil {
+			return nil, err
+		}
+		return &typedPattern{pt, route, syntaxPos{right[0].Pos}}, nil
+	}
+	return nil, ErrorAt(tks[0].Pos, errors.New("Invalid pattern"))
+}
+
+func parseTuplePattern(items [][]Token, pos Position) (pattern, error) {
+	tuple := &tuplePattern{make([]pattern, len(items)), syntaxPos{pos}}
+	for i, item := range items {
+		var err error
+		if tuple.elements[i], err = parsePatternItem(item); err != nil {
+			return nil, err
+		}
+	}
+	return tuple, nil
+}
+
+func parseNamedPattern(items [][]Token, pos Position) (pattern, error) {
+	named := &namedPattern{make([]string, len(items)), make([]pattern, len(items)), syntaxPos{pos}}
+	for i, item := range items {
+		field, rest, err := expectT(item, IdToken)
+		if err != nil {
+			return nil, err
+		}
+		if rest, err = expect(rest, DOUBLES); err != nil {
+			return nil, ErrorAt(field.Pos, errors.New("Can not mix named and positional items in a pattern"))
+		}
+		named.fields[i] = field.Data
+		if named.elements[i], err = parsePatternItem(rest); err != nil {
+			return nil, err
+		}
+	}
+	return named, nil
+}
+
+//Consumes the value on top of the stack binding its parts, if declare is set the variables are created
+func (p *Parser) destructure(pt pattern, tp OBJType, declare bool, mutable bool, stack *[]Instruction) error {
+	if declare {
+		names := make(map[string]bool)
+		if err := checkPatternNames(pt, names); err != nil {
+			return err
+		}
+	}
+	return ErrorAt(pt.position(), p.destructureInto(pt, tp, declare, mutable, stack))
+}
+
+func checkPatternNames(pt pattern, names map[string]bool) error {
+	switch v := pt.(type) {
+	case *bindPattern:
+		if names[v.name] {
+			return ErrorAt(v.pos, fmt.Errorf("Name %s bound more than once", v.name))
+		}
+		names[v.name] = true
+	case *typedPattern:
+		return checkPatternNames(v.inner, names)
+	case *somePattern:
+		return checkPatternNames(v.inner, names)
+	case *variantPattern:
+		if v.fields != nil {
+			return checkPatternNames(v.fields, names)
+		}
+	case *tuplePattern:
+		for _, e := range v.elements {
+			if err := checkPatternNames(e, names); err != nil {
+				return err
+			}
+		}
+	case *namedPattern:
+		for _, e := range v.elements {
+			if err := checkPatternNames(e, names); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Parser) destructureInto(pt pattern, tp OBJType, declare bool, mutable bool, stack *[]Instruction) error {
+	switch v := asVariant(pt, tp).(type) {
+	case *variantPattern:
+		fields, err := variantFields(v, tp)
+		if err != nil {
+			return err
+		}
+		coverage := newVariantCoverage(tp)
+		coverage.cover(v, tp)
+		if err = coverage.check(); err != nil {
+			return err
+		}
+		for i, f := range fields {
+			if err := p.destructureItem(v.fields.elements[i], f, i+1, declare, mutable, stack); err != nil {
+				return err
+			}
+		}
+		*stack = append(*stack, MKInstruction(POP))
+	case *valuePattern, *somePattern:
+		return errors.New("Only patterns that always match can assign values")
+	case *typedPattern:
+		if tp.Primitive() == ANY {
+			return errors.New("Only patterns that always match can assign values")
+		}
+		target, err := p.patternType(v, tp)
+		if err != nil {
+			return err
+		}
+		return p.destructureInto(v.inner, target, declare, mutable, stack)
+	case *wildcardPattern:
+		*stack = append(*stack, MKInstruction(POP))
+	case *bindPattern:
+		return ErrorAt(v.pos, p.bindVariable(v.name, tp, declare, mutable, stack))
+	case *tuplePattern:
+		items := tp.FixedItems()
+		if items == nil {
+			return fmt.Errorf("Type %s can not be destructured", Repr(tp))
+		}
+		if len(items) != len(v.elements) {
+			return fmt.Errorf("Expecting %d items to destructure %s, found %d", len(items), Repr(tp), len(v.elements))
+		}
+		for i, e := range v.elements {
+			if err := p.destructureItem(e, items[i], i, declare, mutable, stack); err != nil {
+				return err
+			}
+		}
+		*stack = append(*stack, MKInstruction(POP))
+	case *namedPattern:
+		fields := tp.NamedItems()
+		if fields == nil {
+			return fmt.Errorf("Type %s does not have named items", Repr(tp))
+		}
+		for i, e := range v.elements {
+			idx, ok := fields[v.fields[i]]
+			if !ok {
+				return fmt.Errorf("Type %s does not have property %s", tp.TypeName(), v.fields[i])
+			}
+			if err := p.destructureItem(e, tp.FixedItems()[idx], idx, declare, mutable, stack); err != nil {
+				return err
+			}
+		}
+		*stack = append(*stack, MKInstruction(POP))
+	}
+	return nil
+}
+
+//A binding named as a variant of the enum being matched refers to the variant
+func asVariant(pt pattern, tp OBJType) pattern {
+	if b, ok := pt.(*bindPattern); ok && tp.Primitive() == ENUM {
+		if _, ex := tp.(*Enum).Variant(b.name); ex {
+			return &variantPattern{b.name, nil, b.syntaxPos}
+		}
+	}
+	return pt
+}
+
+//Types of the fields checked by the pattern, nil if the pattern only checks the tag
+func variantFields(pt *variantPattern, tp OBJType) ([]OBJType, error) {
+	if tp.Primitive() != ENUM {
+		return nil, ErrorAt(pt.pos, fmt.Errorf("Variant pattern %s can not match %s", pt.name, Repr(tp)))
+	}
+	enum := tp.(*Enum)
+	idx, ex := enum.Variant(pt.name)
+	if !ex {
+		return nil, ErrorAt(pt.pos, fmt.Errorf("Enum %s does not have variant %s", enum.Name, pt.name))
+	}
+	if pt.fields == nil {
+		return nil, nil
+	}
+	if len(pt.fields.elements) != len(enum.Fields[idx]) {
+		return nil, ErrorAt(pt.pos, fmt.Errorf("Variant %s has %d fields, found %d", pt.name, len(enum.Fields[idx]), len(pt.fields.elements)))
+	}
+	return enum.Fields[idx], nil
+}
+
+//Keeps the container on the stack while the item at idx is bound
+func (p *Parser) destructureItem(pt pattern, tp OBJType, idx int, declare bool, mutable bool, stack *[]Instruction) error {
+	if _, skip := pt.(*wildcardPattern); skip {
+		return nil
+	}
+	*stack = append(*stack, MKInstruction(DUP), MKInstruction(ACC, nil, idx))
+	return ErrorAt(pt.position(), p.destructureInto(pt, tp, declare, mutable, stack))
+}
+
+func (p *Parser) bindVariable(name string, tp OBJType, declare bool, mutable bool, stack *[]Instruction) error {
+	if tp.Primitive() == VOID {
+		return errors.New("Void can not be assigned as a value")
+	}
+	if declare {
+		if tp.Primitive() == FUNCTION && mutable {
+			return errors.New("Function declaration must be constant")
+		}
+		p.currentScope().CreateVariable(name, tp, mutable, false)
+	}
+	ins, err := p.currentScope().SetVariableIns(name, tp)
+	if err != nil {
+		return err
+	}
+	*stack = append(*stack, ins)
+	if declare && tp.Primitive() == FUNCTION {
+		return p.functionFromVariable(name)
+	}
+	return nil
+}
+
+func (p *Parser) patternType(pt *typedPattern, tp OBJType) (OBJType, error) {
+	name, scope, err := getNameAndScope(p, pt.typeName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := scope.FetchType(name)
+	if err != nil {
+		return nil, err
+	}
+	if tp.Primitive() == ANY {
+		if _, ok := runtimeKind(*target); ok {
+			return *target, nil
+		}
+		return nil, fmt.Errorf("Type %s can not be checked over Any", Repr(*target))
+	}
+	if generic, ok := (*target).(*GenericStructure); ok {
+		if s, ok := tp.(*Structure); ok && s.Generic == generic {
+			return tp, nil
+		}
+	}
+	if !CompareTypes(*target, tp) {
+		return nil, fmt.Errorf("Pattern of type %s can not match %s", Repr(*target), Repr(tp))
+	}
+	return *target, nil
+}
+
+//Types whose values are told apart when run, so they can be checked over Any
+func runtimeKind(tp OBJType) (string, bool) {
+	switch tp.Primitive() {
+	case INTEGER, DECIMAL, STRING, PROCESS:
+		return tp.TypeName(), true
+	}
+	return "", false
+}
+
+func extendLoad(load []Instruction, ins ...Instruction) []Instruction {
+	res := make([]Instruction, 0, len(load)+len(ins))
+	return append(append(res, load...), ins...)
+}
+
+//Emits the checks of a pattern, load pushes the tested value and every failed check is a jump to patch
+func (p *Parser) testPattern(pt pattern, tp OBJType, load []Instruction, fails *[]int) error {
+	switch v := asVariant(pt, tp).(type) {
+	case *variantPattern:
+		fields, err := variantFields(v, tp)
+		if err != nil {
+			return err
+		}
+		p.addInstructions(load)
+		p.addInstructions([]Instruction{MKInstruction(ACC, nil, 0), MKInstruction(PSH, v.name), MKInstruction(EQV)})
+		*fails = append(*fails, p.addInstruction(MKInstruction(MVF)))
+		for i, e := range fields {
+			if err := p.testPattern(v.fields.elements[i], e, extendLoad(load, MKInstruction(ACC, nil, i+1)), fails); err != nil {
+				return err
+			}
+		}
+	case *valuePattern:
+		value := make([]Instruction, 0)
+		vt, err := runBranch(v.value, p, &value)
+		if err != nil {
+			return err
+		}
+		if !CompareTypes(vt, tp) {
+			return ErrorAt(v.pos, fmt.Errorf("Pattern of type %s can not match %s", Repr(vt), Repr(tp)))
+		}
+		p.addInstructions(load)
+		p.addInstructions(value)
+		p.addInstruction(MKInstruction(EQV))
+		*fails = append(*fails, p.addInstruction(MKInstruction(MVF)))
+	case *somePattern:
+		if tp.Primitive() != NULL {
+			return ErrorAt(v.pos, fmt.Errorf("Pattern some can not match %s", Repr(tp)))
+		}
+		p.addInstructions(load)
+		p.addInstructions([]Instruction{MKInstruction(PSH, Null{}), MKInstruction(EQV), MKInstruction(NOTB)})
+		*fails = append(*fails, p.addInstruction(MKInstruction(MVF)))
+		return p.testPattern(v.inner, tp.Items(), load, fails)
+	case *typedPattern:
+		target, err := p.patternType(v, tp)
+		if err != nil {
+			return ErrorAt(v.pos, err)
+		}
+		if tp.Primitive() == ANY {
+			kind, _ := runtimeKind(target)
+			p.addInstructions(load)
+			p.addInstruction(MKInstruction(ISK, nil, kind))
+			*fails = append(*fails, p.addInstruction(MKInstruction(MVF)))
+		}
+		return p.testPattern(v.inner, target, load, fails)
+	case *tuplePattern:
+		items := tp.FixedItems()
+		if tp.Primitive() == ANY {
+			p.addInstructions(load)
+			p.addInstruction(MKInstruction(ISV, nil, len(v.elements)))
+			*fails = append(*fails, p.addInstruction(MKInstruction(MVF)))
+			items = make([]OBJType, len(v.elements))
+			for i := range items {
+				items[i] = Any
+			}
+		} else if items == nil {
+			return ErrorAt(v.pos, fmt.Errorf("Type %s can not be destructured", Repr(tp)))
+		} else if len(items) != len(v.elements) {
+			return ErrorAt(v.pos, fmt.Errorf("Expecting %d items to destructure %s, found %d", len(items), Repr(tp), len(v.elements)))
+		}
+		for i, e := range v.elements {
+			if err := p.testPattern(e, items[i], extendLoad(load, MKInstruction(ACC, nil, i)), fails); err != nil {
+				return err
+			}
+		}
+	case *namedPattern:
+		fields := tp.NamedItems()
+		if fields == nil {
+			return ErrorAt(v.pos, fmt.Errorf("Type %s does not have named items", Repr(tp)))
+		}
+		for i, e := range v.elements {
+			idx, ok := fields[v.fields[i]]
+			if !ok {
+				return ErrorAt(v.pos, fmt.Errorf("Type %s does not have property %s", tp.TypeName(), v.fields[i]))
+			}
+			if err := p.testPattern(e, tp.FixedItems()[idx], extendLoad(load, MKInstruction(ACC, nil, idx)), fails); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Declares the variables of a pattern already tested, as constants
+func (p *Parser) bindPattern(pt pattern, tp OBJType, load []Instruction) error {
+	names := make(map[string]bool)
+	if err := checkPatternNames(pt, names); err != nil {
+		return err
+	}
+	stack := make([]Instruction, 0)
+	if err := p.bindPatternInto(pt, tp, load, &stack); err != nil {
+		return err
+	}
+	p.addInstructions(stack)
+	return nil
+}
+
+func (p *Parser) bindPatternInto(pt pattern, tp OBJType, load []Instruction, stack *[]Instruction) error {
+	switch v := asVariant(pt, tp).(type) {
+	case *variantPattern:
+		fields, _ := variantFields(v, tp)
+		for i, e := range fields {
+			if err := p.bindPatternInto(v.fields.elements[i], e, extendLoad(load, MKInstruction(ACC, nil, i+1)), stack); err != nil {
+				return err
+			}
+		}
+	case *bindPattern:
+		*stack = append(*stack, load...)
+		return ErrorAt(v.pos, p.bindVariable(v.name, tp, true, false, stack))
+	case *somePattern:
+		return p.bindPatternInto(v.inner, tp.Items(), load, stack)
+	case *typedPattern:
+		target, err := p.patternType(v, tp)
+		if err != nil {
+			return err
+		}
+		return p.bindPatternInto(v.inner, target, load, stack)
+	case *tuplePattern:
+		for i, e := range v.elements {
+			item := Any
+			if tp.Primitive() != ANY {
+				item = tp.FixedItems()[i]
+			}
+			if err := p.bindPatternInto(e, item, extendLoad(load, MKInstruction(ACC, nil, i)), stack); err != nil {
+				return err
+			}
+		}
+	case *namedPattern:
+		for i, e := range v.elements {
+			idx := tp.NamedItems()[v.fields[i]]
+			if err := p.bindPatternInto(e, tp.FixedItems()[idx], extendLoad(load, MKInstruction(ACC, nil, idx)), stack); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//Tracks which variants of an enum are handled, other types need no coverage
+type variantCoverage struct {
+	enum    *Enum
+	all     bool
+	covered map[string]bool
+}
+
+func newVariantCoverage(tp OBJType) *variantCoverage {
+	if tp.Primitive() != ENUM {
+		return &variantCoverage{nil, true, nil}
+	}
+	return &variantCoverage{tp.(*Enum), false, make(map[string]bool)}
+}
+
+func (c *variantCoverage) cover(pt pattern, tp OBJType) {
+	if c.all {
+		return
+	}
+	switch v := asVariant(pt, tp).(type) {
+	case *variantPattern:
+		fields, err := variantFields(v, tp)
+		if err != nil {
+			return
+		}
+		for i, f := range fields {
+			if !irrefutable(v.fields.elements[i], f) {
+				return
+			}
+		}
+		c.covered[v.name] = true
+	default:
+		c.all = irrefutable(pt, tp)
+	}
+}
+
+func (c *variantCoverage) check() error {
+	if c.all {
+		return nil
+	}
+	missing := ""
+	for _, v := range c.enum.Variants {
+		if !c.covered[v] {
+			if len(missing) > 0 {
+				missing += ", "
+			}
+			missing += v
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Non-exhaustive handling of %s, missing variants: %s", c.enum.Name, missing)
+	}
+	return nil
+}
+
+//Variants handled by a chain of if val over the same value, the chain must handle them all unless it ends with else
+type ifChain struct {
+	pos      Position
+	subject  string
+	coverage *variantCoverage
+	arms     int
+	broken   bool //A condition is not a pattern over the same value
+}
+
+func (c *ifChain) add(subject string, pt pattern, tp OBJType) {
+	if c.broken {
+		return
+	}
+	if c.arms == 0 {
+		c.subject, c.coverage = subject, newVariantCoverage(tp)
+	} else if subject != c.subject {
+		c.broken = true
+		return
+	}
+	c.coverage.cover(pt, tp)
+	c.arms++
+}
+
+//A lone if val tests a single variant on purpose, longer chains are checked like a match
+func (c *ifChain) check() error {
+	if c.broken || c.arms < 2 {
+		return nil
+	}
+	return ErrorAt(c.pos, c.coverage.check())
+}
+
+//Whether the pattern matches every value of the type
+func irrefutable(pt pattern, tp OBJType) bool {
+	switch v := asVariant(pt, tp).(type) {
+	case *wildcardPattern, *bindPattern:
+		return true
+	case *typedPattern:
+		return tp.Primitive() != ANY && irrefutable(v.inner, tp)
+	case *tuplePattern:
+		items := tp.FixedItems()
+		if len(items) != len(v.elements) {
+			return false
+		}
+		for i, e := range v.elements {
+			if !irrefutable(e, items[i]) {
+				return false
+			}
+		}
+		return true
+	case *namedPattern:
+		for i, e := range v.elements {
+			idx, ok := tp.NamedItems()[v.fields[i]]
+			if !ok || !irrefutable(e, tp.FixedItems()[idx]) {
+				return false
+			}
+		}
+		return true
+	case *variantPattern:
+		coverage := newVariantCoverage(tp)
+		coverage.cover(v, tp)
+		return coverage.check() == nil
+	}
+	return false
+}
@@ -4,7 +4,10 @@ import (
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
+	"github.com/besten/internal/lexer"
 	"github.com/besten/internal/runtime"
 )
 
@@ -32,10 +35,46 @@ func (p *Parser) solveFunctionCall(name string, operator bool, callers []OBJType
 			*into = append(*into, runtime.MKInstruction(runtime.CSE, len(insbuffers)-len(sym.Args)+1))
 		}
 	}
+	if info, ok := p.closures[sym.CName]; ok {
+		var env []runtime.Instruction
+		if env, err = p.closureEnvironment(sym.CName, info); err != nil {
+			return
+		}
+		*into = append(*into, env...)
+	}
 	*into = append(*into, sym.Call...)
 	return
 }
 
+//Loads the variables captured by a closure, the closure itself passes its own environment
+func (p *Parser) closureEnvironment(cname string, info *closureInfo) ([]runtime.Instruction, error) {
+	if len(p.fragmenttrack) > 0 && p.activeFragment() == cname {
+		return runtime.MKInstruction(runtime.LEI, 0).Fragment(), nil
+	}
+	ins := make([]runtime.Instruction, 0, len(info.captured)+1)
+	for i := len(info.captured) - 1; i >= 0; i-- {
+		load, err := p.currentScope().loadVariable(info.captured[i])
+		if err != nil {
+			return nil, err
+		}
+		ins = append(ins, load)
+	}
+	return append(ins, runtime.MKInstruction(runtime.CSE, len(info.captured))), nil
+}
+
+//Instructions to push a function as a value, closures are bound to their environment
+func (p *Parser) functionValue(cname string) ([]runtime.Instruction, error) {
+	info, ok := p.closures[cname]
+	if !ok {
+		return runtime.MKInstruction(runtime.PSH, cname).Fragment(), nil
+	}
+	env, err := p.closureEnvironment(cname, info)
+	if err != nil {
+		return nil, err
+	}
+	return append(env, runtime.MKInstruction(runtime.MKC, cname)), nil
+}
+
 func (p *Parser) getSymbolForCall(name string, operator bool, callers []OBJType) (sym *FunctionSymbol, err error) {
 	if operator && (len(callers) > 2 || len(callers) < 1) {
 		err = fmt.Errorf("Operators cannot have %d arguments", len(callers))
@@ -108,12 +147,7 @@ func (p *Parser) generateFunctionTemplate(name string, operator bool, template F
 
 //Remember: This function does not check if there is another function with that types
 func (p *Parser) generateFunctionFromTemplate(name string, operator bool, callers []OBJType) (sym *FunctionSymbol, err error) {
-	var template *FunctionTemplate
-	if operator {
-		template = p.currentScope().Operators.FindTemplate(name, len(callers))
-	} else {
-		template = p.currentScope().Functions.FindTemplate(name, len(callers))
-	}
+	template := p.findTemplate(name, operator, len(callers))
 	if template == nil {
 		symboltype := "function"
 		if operator {
@@ -126,10 +160,27 @@ func (p *Parser) generateFunctionFromTemplate(name string, operator bool, caller
 }
 
 func (p *Parser) generateFunctionFromRawTemplate(name string, operator bool, callers []OBJType, template *FunctionTemplate) (sym *FunctionSymbol, err error) {
+	if err = p.checkConstraints(name, template, callers); err != nil {
+		return
+	}
 	compilename := generateFnUUID(name, p.rootscope.DataModule.Name(), len(template.Args), template.Varargs, false)
 
 	originScope := p.currentScope()
-	p.openFragmentFor(compilename, len(template.Args))
+	if template.Outer == nil {
+		p.openFragmentFor(compilename, len(template.Args))
+	} else {
+		//The environment is received as a hidden first argument
+		p.openFragmentFor(compilename, len(template.Args)+1)
+		scope := p.currentScope()
+		scope.closure = &closureInfo{template.Outer, make([]*Variable, 0)}
+		scope.Functions = template.Outer.Functions.Fork()
+		scope.Operators = template.Outer.Operators.Fork()
+		if err = scope.ImportFixities(template.Outer); err != nil {
+			return
+		}
+		scope.CreateVariable("*env", Any, false, true)
+		p.closures[compilename] = scope.closure
+	}
 
 	args := make([]OBJType, 0)
 
@@ -179,7 +230,11 @@ func (p *Parser) generateFunctionFromRawTemplate(name string, operator bool, cal
 		return
 	}
 
-	err = p.parseBlocks(template.Children, Function)
+	if template.Expression != nil {
+		err = p.parseReturnOf(template.Expression, nil)
+	} else {
+		err = p.parseBlocks(template.Children, Function)
+	}
 	if err != nil {
 		return
 	}
@@ -193,10 +248,64 @@ func (p *Parser) generateFunctionFromRawTemplate(name string, operator bool, cal
 	if err = p.currentScope().CheckClose(); err != nil {
 		return
 	}
+	p.describeSymbol(compilename, name, args, template.Pos)
 	p.backToFragment()
 	return
 }
 
+//Callers must implement the interfaces and match the types declared by the template
+func (p *Parser) checkConstraints(name string, template *FunctionTemplate, callers []OBJType) error {
+	if template.Constraints == nil {
+		return nil
+	}
+	for i, tp := range callers {
+		c := i
+		if i >= len(template.Args)-1 && template.Varargs {
+			c = len(template.Args) - 1
+			if tp.Primitive() == VARIADIC {
+				tp = tp.Items()
+			}
+		} else if i >= len(template.Args) {
+			break
+		}
+		constraint := template.Constraints[c]
+		if iface, ok := constraint.(*Interface); ok {
+			if missing := p.missingRequirements(iface, tp); len(missing) > 0 {
+				return fmt.Errorf("Argument %s of %s: type %s does not implement %s, missing: %s",
+					template.Args[c], name, Repr(tp), iface.Name, strings.Join(missing, ", "))
+			}
+		} else if !CompareTypes(constraint, tp) {
+			return fmt.Errorf("Argument %s of %s: expecting %s instead of %s", template.Args[c], name, Repr(constraint), Repr(tp))
+		}
+	}
+	return nil
+}
+
+//Templates are assumed to fit, their return is only known once instanced
+func (p *Parser) missingRequirements(iface *Interface, tp OBJType) []string {
+	missing := make([]string, 0)
+	self := []OBJType{tp}
+	for _, r := range iface.Requirements {
+		args := substituteTypes(r.Args, self)
+		if sym, ok := p.findFunction(r.Name, r.Operator, args); ok {
+			if r.Return == nil || CompareTypes(substituteType(r.Return, self), *sym.Return) {
+				continue
+			}
+		} else if p.findTemplate(r.Name, r.Operator, len(args)) != nil {
+			continue
+		}
+		missing = append(missing, r.Repr(tp))
+	}
+	return missing
+}
+
+func (p *Parser) findTemplate(name string, operator bool, args int) *FunctionTemplate {
+	if operator {
+		return p.currentScope().Operators.FindTemplate(name, args)
+	}
+	return p.currentScope().Functions.FindTemplate(name, args)
+}
+
 func (p *Parser) functionFromVariable(name string) error {
 	ins, fnt, e := p.currentScope().GetVariableIns(name)
 	if e != nil {
@@ -215,6 +324,17 @@ func (p *Parser) functionFromVariable(name string) error {
 	return nil
 }
 
+//Keeps the source name, location and variable names of the symbol for the traces and the debugger
+func (p *Parser) describeSymbol(compilename, name string, args []OBJType, pos lexer.Position) {
+	types := make([]string, len(args))
+	for i, a := range args {
+		types[i] = Repr(a)
+	}
+	names := p.currentScope().names
+	p.symbols[compilename].Info = &runtime.SymbolInfo{Function: name, Args: types, File: pos.Origin, Line: pos.Line,
+		ArgNames: names.args, Locals: names.locals}
+}
+
 func (p *Parser) getFunctionTypeFrom(name string, fn *FunctionSymbol) (OBJType, string) {
 	compilename := fn.CName
 	if len(fn.Call) != 1 || fn.Call[0].Code != runtime.CLL {
@@ -227,6 +347,9 @@ func (p *Parser) getFunctionTypeFrom(name string, fn *FunctionSymbol) (OBJType,
 	return FunctionTypeOf(fn.Args, *fn.Return), compilename
 }
 
+//Modules are parsed concurrently
+var countersLock sync.Mutex
+
 var counters map[struct {
 	string
 	int
@@ -236,6 +359,8 @@ var counters map[struct {
 }]*int)
 
 func generateFnUUID(name, module string, args int, varargs, shared bool) string {
+	countersLock.Lock()
+	defer countersLock.Unlock()
 	v, e := counters[struct {
 		string
 		int
@@ -0,0 +1,30 @@
+package parser
+
+import (
+	"sync"
+	"testing"
+)
+
+//Run with -race, the modules parsed at the same time share the counters
+func TestGenerateFnUUIDConcurrently(t *testing.T) {
+	var group sync.WaitGroup
+	names := make(chan string, 400)
+	for i := 0; i < 4; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for j := 0; j < 100; j++ {
+				names <- generateFnUUID("concurrent", "module", 1, false, false)
+			}
+		}()
+	}
+	group.Wait()
+	close(names)
+	seen := make(map[string]bool)
+	for name := range names {
+		if seen[name] {
+			t.Fatalf("Name %s generated twice", name)
+		}
+		seen[name] = true
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 
+	. "github.com/besten/internal/lexer"
 	. "github.com/besten/internal/runtime"
 )
 
@@ -23,6 +24,15 @@ type LoopInfo struct {
 		position int
 		skip     bool
 	}
+	guards *guard //Regions already open when the loop began
+}
+
+//Rescue or ensure region, open from its declaration to the end of the enclosing block
+type guard struct {
+	parent   *guard
+	ensure   []Block //Cleanup run whenever the region is left, nil for rescues
+	scp      ScopeCtx
+	handlers []int //Jumps from the end of the handler to the end of the region
 }
 
 func (li *LoopInfo) insertJump(position int, skip bool) {
@@ -47,6 +57,33 @@ type ifFlags struct {
 	afterif    bool
 	lastifhead struct{ idx, offset int }
 	allifskips []struct{ idx, offset int }
+	chain      *ifChain
+}
+
+//Binding strength of an infix operator, higher levels bind tighter
+type Fixity struct {
+	Level int
+	Right bool
+}
+
+//Fixity for operators without declaration
+var defaultFixity = Fixity{9, false}
+
+//Variables an inner function takes from the functions enclosing it
+type closureInfo struct {
+	outer    *Scope
+	captured []*Variable
+}
+
+//Position of the variable inside the closure environment, it is captured if needed
+func (c *closureInfo) capture(v *Variable) int {
+	for i, o := range c.captured {
+		if o == v {
+			return i
+		}
+	}
+	c.captured = append(c.captured, v)
+	return len(c.captured) - 1
 }
 
 type returnLnFlag struct {
@@ -55,7 +92,7 @@ type returnLnFlag struct {
 }
 
 func createIfFlags() *ifFlags {
-	return &ifFlags{false, false, struct{ idx, offset int }{-1, -1}, make([]struct{ idx, offset int }, 0)}
+	return &ifFlags{false, false, struct{ idx, offset int }{-1, -1}, make([]struct{ idx, offset int }, 0), nil}
 }
 
 func createReturnLnFlag() *returnLnFlag {
@@ -92,6 +129,7 @@ type Scope struct {
 	DefinedTypes    map[string]*OBJType
 	Functions       *FunctionCollection
 	Operators       *FunctionCollection
+	Fixities        map[string]Fixity
 	ifFlags         *ifFlags
 	loopInfo        *LoopInfo
 	returnLnFlag    *returnLnFlag
@@ -100,14 +138,22 @@ type Scope struct {
 	parent          *Scope
 	varcount        *uint
 	argcount        *uint
-	hasRescue       bool
+	guards          *guard
+	closure         *closureInfo
+	names           *slotNames
+}
+
+//Names of the variables of a function by slot, for the debugger
+type slotNames struct {
+	args   []string
+	locals []string
 }
 
 func (s *Scope) forkLoopInfo() {
 	s.loopInfo = &LoopInfo{s.loopInfo, make([]struct {
 		position int
 		skip     bool
-	}, 0)}
+	}, 0), s.guards}
 }
 
 func (s *Scope) closeLoopInfo() {
@@ -133,22 +179,56 @@ func (s *Scope) CreateVariable(name string, t OBJType, mutable bool, arg bool) {
 	if arg {
 		s.Variables[name].Code = *s.argcount
 		*s.argcount++
+		s.names.args = append(s.names.args, name)
 	} else {
 		s.Variables[name].Code = *s.varcount
 		*s.varcount++
+		s.names.locals = append(s.names.locals, name)
 	}
 }
 
-func (s *Scope) GetVariableIns(name string) (Instruction, OBJType, error) {
+//Variable only reachable by the compiler, the name can not collide with user names
+func (s *Scope) CreateHiddenVariable(name string, t OBJType) int {
+	name = "*" + name
+	s.CreateVariable(name, t, true, false)
+	s.Variables[name].Asigned = true
+	s.Variables[name].Used = true
+	return int(s.Variables[name].Code)
+}
+
+//Searches the variable in the scope and then in the scopes the function closes over
+func (s *Scope) lookupVariable(name string) (*Variable, bool) {
 	if v, e := s.Variables[name]; e {
+		return v, true
+	}
+	if s.closure != nil {
+		return s.closure.outer.lookupVariable(name)
+	}
+	return nil, false
+}
+
+//Variables of enclosing functions are loaded from the closure environment
+func (s *Scope) loadVariable(v *Variable) (Instruction, error) {
+	if v.Dependency.varcount == s.varcount {
+		if v.Arg {
+			return MKInstruction(LEI, int(v.Code)), nil
+		}
+		return MKInstruction(LLI, int(v.Code)), nil
+	}
+	if s.closure == nil {
+		return MKInstruction(NOP), errors.New("Variable out of the function reach")
+	}
+	return MKInstruction(LCI, s.closure.capture(v)), nil
+}
+
+func (s *Scope) GetVariableIns(name string) (Instruction, OBJType, error) {
+	if v, e := s.lookupVariable(name); e {
 		if !v.Asigned {
 			return MKInstruction(NOP), nil, fmt.Errorf("A value has not been set for: %s", name)
 		}
-		var ins Instruction
-		if v.Arg {
-			ins = MKInstruction(LEI, int(v.Code))
-		} else {
-			ins = MKInstruction(LLI, int(v.Code))
+		ins, err := s.loadVariable(v)
+		if err != nil {
+			return ins, nil, err
 		}
 		v.Used = true
 		return ins, v.Type, nil
@@ -177,6 +257,9 @@ func (s *Scope) SetVariableIns(name string, t OBJType) (Instruction, error) {
 		v.Asigned = true
 		return ins, nil
 	}
+	if _, e := s.lookupVariable(name); e {
+		return MKInstruction(NOP), fmt.Errorf("Captured variable can not be assigned: %s", name)
+	}
 	return MKInstruction(NOP), fmt.Errorf("Undefined variable: %s", name)
 }
 
@@ -206,11 +289,12 @@ func NewScope(name string) *Scope {
 		DefinedTypes:    make(map[string]*OBJType),
 		Functions:       NewFunctionCollection(),
 		Operators:       NewFunctionCollection(),
+		Fixities:        make(map[string]Fixity),
 		ifFlags:         createIfFlags(),
 		loopInfo:        nil,
 		returnLnFlag:    createReturnLnFlag(),
 		ReturnType:      &rptr, Returned: &r, parent: nil,
-		varcount: &vc, argcount: &ac, hasRescue: false}
+		varcount: &vc, argcount: &ac, guards: nil, names: &slotNames{}}
 	scope.DataModule = &FileModule{name, scope}
 	return scope
 }
@@ -219,7 +303,13 @@ func (s *Scope) Open(fnscope bool) *Scope {
 	returnt := s.ReturnType
 	returned := s.Returned
 	vc, ac := s.varcount, s.argcount
+	closure := s.closure
+	guards := s.guards
+	names := s.names
 	if fnscope {
+		closure = nil
+		guards = nil
+		names = &slotNames{}
 		rptr := Void
 		returnt = &rptr
 		isret := false
@@ -234,11 +324,12 @@ func (s *Scope) Open(fnscope bool) *Scope {
 		DefinedTypes:    make(map[string]*OBJType),
 		Functions:       s.Functions.Fork(),
 		Operators:       s.Operators.Fork(),
+		Fixities:        make(map[string]Fixity),
 		ifFlags:         createIfFlags(),
 		loopInfo:        s.loopInfo,
 		returnLnFlag:    createReturnLnFlag(),
 		ReturnType:      returnt, Returned: returned, parent: s,
-		varcount: vc, argcount: ac, hasRescue: s.hasRescue}
+		varcount: vc, argcount: ac, guards: guards, closure: closure, names: names}
 	for k, v := range s.ImportedModules {
 		ns.ImportedModules[k] = v
 	}
@@ -248,6 +339,9 @@ func (s *Scope) Open(fnscope bool) *Scope {
 	for k, v := range s.DefinedTypes {
 		ns.DefinedTypes[k] = v
 	}
+	for k, v := range s.Fixities {
+		ns.Fixities[k] = v
+	}
 	return ns
 }
 
@@ -273,12 +367,39 @@ func (s *Scope) ImportFrom(other *Scope) error {
 		}
 		s.DefinedTypes[k] = v
 	}
+	if e := s.ImportFixities(other); e != nil {
+		return e
+	}
 	if e := s.Operators.CopyFrom(other.Operators); e != nil {
 		return e
 	}
 	return s.Functions.CopyFrom(other.Functions)
 }
 
+func (s *Scope) DeclareFixity(operator string, fixity Fixity) error {
+	if f, ex := s.Fixities[operator]; ex && f != fixity {
+		return fmt.Errorf("Operator %s already has a different precedence", operator)
+	}
+	s.Fixities[operator] = fixity
+	return nil
+}
+
+func (s *Scope) ImportFixities(other *Scope) error {
+	for k, v := range other.Fixities {
+		if e := s.DeclareFixity(k, v); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *Scope) FixityOf(operator string) Fixity {
+	if f, ex := s.Fixities[operator]; ex {
+		return f
+	}
+	return defaultFixity
+}
+
 func (s *Scope) OpenForeignScope(other *Scope) *Scope {
 	n := *other
 	n.parent = s
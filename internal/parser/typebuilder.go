@@ -12,7 +12,7 @@ func solveTypeFromTokens(tokens []Token, allowany bool) (OBJType, error) {
 }
 
 func solveContextedTypeFromTokens(tokens []Token, parser *Parser, allowany bool) (OBJType, error) {
-	parts, err := splitByToken(tokens, func(t Token) bool { return t == SPLITTER }, genericPairs, false, false, false)
+	parts, err := splitByToken(tokens, func(t Token) bool { return t.Is(SPLITTER) }, genericPairs, false, false, false)
 	if err != nil {
 		return nil, err
 	}
@@ -27,7 +27,7 @@ func genericSolveType(parts [][]Token, parser *Parser, allowany bool, allowvoid
 	if len(base) == 0 {
 		return nil, errors.New("Void type")
 	}
-	if base[0] == REF {
+	if base[0].Is(REF) {
 		if parser == nil {
 			return nil, errors.New("Referenced type is not valid in the current context")
 		}
@@ -38,8 +38,14 @@ func genericSolveType(parts [][]Token, parser *Parser, allowany bool, allowvoid
 		o, _, err := parser.parseExpressionInto(exp, nil, false)
 		return o, err
 	}
-	if base[0] == CBOPEN {
-		if base[len(base)-1] != CBCLOSE {
+	if base[0].Is(POPEN) {
+		if !base[len(base)-1].Is(PCLOSE) || len(parts) > 1 {
+			return nil, errors.New("Expecting type between parenthesis")
+		}
+		return solveContextedTypeFromTokens(base[1:len(base)-1], parser, allowany)
+	}
+	if base[0].Is(CBOPEN) {
+		if !base[len(base)-1].Is(CBCLOSE) {
 			return nil, errors.New("Expecting tuple closer")
 		}
 		return solveTypeTuple(parts, parser, allowany)
@@ -63,9 +69,29 @@ func genericSolveType(parts [][]Token, parser *Parser, allowany bool, allowvoid
 		return solveTypeVec(parts[1:], parser, allowany)
 	case "Map":
 		return solveTypeMap(parts[1:], parser, allowany)
+	case "Opt":
+		return solveTypeOpt(parts[1:], parser, allowany)
+	case "Chan":
+		inner, e := genericSolveType(parts[1:], parser, allowany, false)
+		if e != nil {
+			return nil, e
+		}
+		if e = checkOptionals(ChanOf(inner)); e != nil {
+			return nil, e
+		}
+		return ChanOf(inner), nil
+	case "Task":
+		inner, e := genericSolveType(parts[1:], parser, allowany, true)
+		if e != nil {
+			return nil, e
+		}
+		return TaskOf(inner), nil
 	default:
 		if parser != nil {
 			obj, e := scope.FetchType(name)
+			if e == nil && (*obj).Primitive() == GENERIC {
+				return solveTypeGeneric((*obj).(*GenericStructure), parts[1:], parser, allowany)
+			}
 			if len(parts) > 1 {
 				return nil, errors.New("Unexpected child type")
 			}
@@ -89,9 +115,43 @@ func solveTypeMap(parts [][]Token, parser *Parser, allowany bool) (OBJType, erro
 	if e != nil {
 		return nil, e
 	}
+	if e = checkOptionals(MapOf(inner)); e != nil {
+		return nil, e
+	}
 	return MapOf(inner), nil
 }
 
+//Each parameter takes one part but the last, that like Vec takes the remaining ones
+func solveTypeGeneric(generic *GenericStructure, parts [][]Token, parser *Parser, allowany bool) (OBJType, error) {
+	if len(parts) < len(generic.Params) {
+		return nil, fmt.Errorf("Type %s expects %d type parameters", generic.TypeName(), len(generic.Params))
+	}
+	args := make([]OBJType, len(generic.Params))
+	for i := range args {
+		param := parts[i : i+1]
+		if i == len(args)-1 {
+			param = parts[i:]
+		}
+		tp, e := genericSolveType(param, parser, allowany, false)
+		if e != nil {
+			return nil, e
+		}
+		args[i] = tp
+	}
+	return generic.Instance(args)
+}
+
+func solveTypeOpt(parts [][]Token, parser *Parser, allowany bool) (OBJType, error) {
+	inner, e := genericSolveType(parts, parser, allowany, false)
+	if e != nil {
+		return nil, e
+	}
+	if e = checkOptionals(OptOf(inner)); e != nil {
+		return nil, e
+	}
+	return OptOf(inner), nil
+}
+
 func solveTypeVec(parts [][]Token, parser *Parser, allowany bool) (OBJType, error) {
 	inner, e := genericSolveType(parts, parser, allowany, false)
 	if e != nil {
@@ -105,7 +165,7 @@ func solveTypeTuple(parts [][]Token, parser *Parser, allowany bool) (OBJType, er
 		return nil, errors.New("Wrong tuple generation type call")
 	}
 	p := parts[0][1 : len(parts[0])-1] //Asume call was {*data*} form like
-	tokens, e := splitByToken(p, func(t Token) bool { return t == COMA }, []struct {
+	tokens, e := splitByToken(p, func(t Token) bool { return t.Is(COMA) }, []struct {
 		open  Token
 		close Token
 	}{{CBOPEN, CBCLOSE}}, false, false, false)
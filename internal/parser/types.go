@@ -2,30 +2,40 @@ package parser
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 
 	"github.com/besten/internal/runtime"
 )
 
-var defaultTypes []OBJType = []OBJType{Void, Int, Dec, Bool, Str, Atom, Any}
+var defaultTypes []OBJType = []OBJType{Void, Int, Dec, Bool, Str, Atom, Any, Pid, RuntimeError, TimeoutError, Mutex, AtomicInt, WaitGroup}
 
 type PrimitiveType uint8
 
 const (
-	VOID     PrimitiveType = 0
-	ANY      PrimitiveType = 1
-	NULL     PrimitiveType = 2
-	INTEGER  PrimitiveType = 3
-	DECIMAL  PrimitiveType = 4
-	BOOL     PrimitiveType = 5
-	STRING   PrimitiveType = 6
-	VECTOR   PrimitiveType = 7
-	MAP      PrimitiveType = 8
-	TUPLE    PrimitiveType = 9
-	STRUCT   PrimitiveType = 10
-	VARIADIC PrimitiveType = 11
-	ALIAS    PrimitiveType = 12
-	FUNCTION PrimitiveType = 13
-	ATOM     PrimitiveType = 14
+	VOID      PrimitiveType = 0
+	ANY       PrimitiveType = 1
+	NULL      PrimitiveType = 2
+	INTEGER   PrimitiveType = 3
+	DECIMAL   PrimitiveType = 4
+	BOOL      PrimitiveType = 5
+	STRING    PrimitiveType = 6
+	VECTOR    PrimitiveType = 7
+	MAP       PrimitiveType = 8
+	TUPLE     PrimitiveType = 9
+	STRUCT    PrimitiveType = 10
+	VARIADIC  PrimitiveType = 11
+	ALIAS     PrimitiveType = 12
+	FUNCTION  PrimitiveType = 13
+	ATOM      PrimitiveType = 14
+	ENUM      PrimitiveType = 15
+	PARAM     PrimitiveType = 16
+	GENERIC   PrimitiveType = 17
+	INTERFACE PrimitiveType = 18
+	TASK      PrimitiveType = 19
+	CHANNEL   PrimitiveType = 20
+	PROCESS   PrimitiveType = 21
+	SYNC      PrimitiveType = 22
 )
 
 func FnCArrRepr(arr []OBJType) string {
@@ -47,7 +57,7 @@ func ArrRepr(arr []OBJType, o, c rune) string {
 func Repr(a OBJType) string {
 	base := a.TypeName()
 	switch a.Primitive() {
-	case VECTOR, MAP, VARIADIC:
+	case VECTOR, MAP, VARIADIC, NULL, TASK, CHANNEL:
 		base += "|" + Repr(a.Items())
 	case TUPLE:
 		return ArrRepr(a.FixedItems(), '{', '}')
@@ -58,6 +68,36 @@ func Repr(a OBJType) string {
 	return base
 }
 
+//Identity of the type for the machine, like its representation but with the names of the types defined
+//in a module qualified by it, so types with the same name in different modules are told apart
+func TypeId(a OBJType) string {
+	base := a.TypeName()
+	if m := a.Module(); m != nil && !m.Is(core) {
+		base = m.Name() + "." + base
+	}
+	switch a.Primitive() {
+	case VECTOR, MAP, VARIADIC, NULL, TASK, CHANNEL:
+		base += "|" + TypeId(a.Items())
+	case TUPLE:
+		return arrId(a.FixedItems())
+	case FUNCTION:
+		fn := a.(*FunctionType)
+		return arrId(fn.args) + "|" + TypeId(fn.ret)
+	}
+	return base
+}
+
+func arrId(arr []OBJType) string {
+	rep := "{"
+	for i, a := range arr {
+		rep += TypeId(a)
+		if i < len(arr)-1 {
+			rep += ","
+		}
+	}
+	return rep + "}"
+}
+
 type OBJType interface {
 	Module() Module                         //For identifying module
 	TypeName() string                       //For identifying type
@@ -104,9 +144,14 @@ func CompareTypes(a, b OBJType) bool {
 		return CompareArrayOfTypes(at.args, bt.args) && CompareTypes(at.ret, bt.ret)
 	}
 	switch a.Primitive() {
-	case VECTOR, MAP, VARIADIC:
+	case VECTOR, MAP, VARIADIC, NULL, TASK, CHANNEL:
 		return CompareTypes(a.Items(), b.Items())
 	case STRUCT:
+		if as, bs := a.(*Structure), b.(*Structure); as.Generic != nil || bs.Generic != nil {
+			return as.Generic == bs.Generic && CompareArrayOfTypes(as.Params, bs.Params)
+		}
+		return a.TypeName() == b.TypeName()
+	case ENUM, PARAM, GENERIC, INTERFACE, SYNC:
 		return a.TypeName() == b.TypeName()
 	case TUPLE:
 		return CompareArrayOfTypes(a.FixedItems(), b.FixedItems())
@@ -150,8 +195,15 @@ var (
 	Str  OBJType = &Literal{STRING, "Str", ""}
 	Atom OBJType = &Literal{ATOM, "Atom", "default"}
 	Any  OBJType = &Literal{ANY, "Any", nil}
+	Pid  OBJType = &Literal{PROCESS, "Pid", nil}
 )
 
+//Errors raised by the machine, like failed assertions or stack overflows
+var RuntimeError OBJType = StructOf([]OBJType{Str}, map[string]int{"message": 0}, runtime.RuntimeErrorType, core)
+
+//Raised by with_timeout when the function does not end in time
+var TimeoutError OBJType = StructOf([]OBJType{Str}, map[string]int{"message": 0}, runtime.TimeoutErrorType, core)
+
 func (nc *Literal) Module() Module {
 	return core
 }
@@ -227,6 +279,191 @@ func (nc *Container) Create() ([]runtime.Instruction, error) {
 	return runtime.MKInstruction(nc.CreateInstruction).Fragment(), nil
 }
 
+//Either a value of the inner type or none, at runtime none is a Null object
+type Optional struct {
+	ItemsType OBJType
+}
+
+func OptOf(t OBJType) OBJType {
+	return &Optional{t}
+}
+
+//Both levels of an optional of an optional would be the same none at runtime, looking up a map
+//or receiving from a channel already gives an optional of its items
+func checkOptionals(t OBJType) error {
+	switch t.Primitive() {
+	case NULL, MAP, CHANNEL:
+		if t.Items().Primitive() == NULL {
+			return fmt.Errorf("%s of an optional is not allowed", map[PrimitiveType]string{NULL: "Optional", MAP: "Map", CHANNEL: "Channel"}[t.Primitive()])
+		}
+	}
+	switch t.Primitive() {
+	case VECTOR, MAP, NULL, CHANNEL, TASK:
+		return checkOptionals(t.Items())
+	case TUPLE:
+		for _, item := range t.FixedItems() {
+			if e := checkOptionals(item); e != nil {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (nc *Optional) Module() Module {
+	return core
+}
+
+func (nc *Optional) TypeName() string {
+	return "Opt"
+}
+
+func (nc *Optional) Primitive() PrimitiveType {
+	return NULL
+}
+
+func (nc *Optional) Items() OBJType {
+	return nc.ItemsType
+}
+
+func (nc *Optional) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *Optional) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *Optional) Create() ([]runtime.Instruction, error) {
+	return runtime.MKInstruction(runtime.PSH, runtime.Null{}).Fragment(), nil
+}
+
+//Handle of a spawned process that returns the inner type
+type TaskType struct {
+	ResultType OBJType
+}
+
+func TaskOf(t OBJType) OBJType {
+	return &TaskType{t}
+}
+
+func (nc *TaskType) Module() Module {
+	return core
+}
+
+func (nc *TaskType) TypeName() string {
+	return "Task"
+}
+
+func (nc *TaskType) Primitive() PrimitiveType {
+	return TASK
+}
+
+func (nc *TaskType) Items() OBJType {
+	return nc.ResultType
+}
+
+func (nc *TaskType) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *TaskType) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *TaskType) Create() ([]runtime.Instruction, error) {
+	return nil, errors.New("Tasks can only be created by spawning a function")
+}
+
+//Sends values of the inner type between processes
+type ChannelType struct {
+	ItemsType OBJType
+}
+
+func ChanOf(t OBJType) OBJType {
+	return &ChannelType{t}
+}
+
+func (nc *ChannelType) Module() Module {
+	return core
+}
+
+func (nc *ChannelType) TypeName() string {
+	return "Chan"
+}
+
+func (nc *ChannelType) Primitive() PrimitiveType {
+	return CHANNEL
+}
+
+func (nc *ChannelType) Items() OBJType {
+	return nc.ItemsType
+}
+
+func (nc *ChannelType) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *ChannelType) NamedItems() map[string]int {
+	return nil
+}
+
+//Unbuffered by default
+func (nc *ChannelType) Create() ([]runtime.Instruction, error) {
+	return runtime.MKInstruction(runtime.MCH, 0).Fragment(), nil
+}
+
+//Synchronization objects shared between processes, every one created is a new object
+type SyncType struct {
+	Name string
+	Make runtime.EmbeddedFunction
+}
+
+func syncType(name string, create func() runtime.Object) OBJType {
+	return &SyncType{name, runtime.EmbeddedFunction{
+		Name:     "new_" + name,
+		ArgCount: 0,
+		Function: func(args []runtime.Object) runtime.Object {
+			return create()
+		},
+		Returns: true,
+	}}
+}
+
+var (
+	Mutex     OBJType = syncType("Mutex", func() runtime.Object { return runtime.NewMutex() })
+	AtomicInt OBJType = syncType("AtomicInt", func() runtime.Object { return &runtime.AtomicIntT{} })
+	WaitGroup OBJType = syncType("WaitGroup", func() runtime.Object { return runtime.NewWaitGroup() })
+)
+
+func (nc *SyncType) Module() Module {
+	return core
+}
+
+func (nc *SyncType) TypeName() string {
+	return nc.Name
+}
+
+func (nc *SyncType) Primitive() PrimitiveType {
+	return SYNC
+}
+
+func (nc *SyncType) Items() OBJType {
+	return nil
+}
+
+func (nc *SyncType) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *SyncType) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *SyncType) Create() ([]runtime.Instruction, error) {
+	return runtime.MKInstruction(runtime.IFD, nc.Make).Fragment(), nil
+}
+
 type Tuple struct {
 	ItemTypes []OBJType
 }
@@ -317,10 +554,12 @@ type Structure struct {
 	Fields    map[string]int
 	Name      string
 	Owner     Module
+	Generic   *GenericStructure //Definition it was instanced from, if any
+	Params    []OBJType
 }
 
 func StructOf(items []OBJType, fields map[string]int, name string, module Module) OBJType {
-	return &Structure{items, fields, name, module}
+	return &Structure{items, fields, name, module, nil, nil}
 }
 
 func (nc *Structure) Module() Module {
@@ -359,6 +598,303 @@ func (nc *Structure) Create() ([]runtime.Instruction, error) {
 	return append(data, runtime.MKInstruction(runtime.CSE, len(nc.ItemTypes))), nil
 }
 
+//Placeholder for a type argument inside a generic definition
+type TypeParameter struct {
+	Name  string
+	Index int
+	Owner Module
+}
+
+func (nc *TypeParameter) Module() Module {
+	return nc.Owner
+}
+
+func (nc *TypeParameter) TypeName() string {
+	return nc.Name
+}
+
+func (nc *TypeParameter) Primitive() PrimitiveType {
+	return PARAM
+}
+
+func (nc *TypeParameter) Items() OBJType {
+	return nil
+}
+
+func (nc *TypeParameter) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *TypeParameter) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *TypeParameter) Create() ([]runtime.Instruction, error) {
+	return nil, fmt.Errorf("Type parameter %s has no default value", nc.Name)
+}
+
+//Structure with type parameters, each set of arguments is instanced as a different structure
+type GenericStructure struct {
+	Params    []string
+	Template  *Structure //Fields are typed with the parameters
+	instances []*Structure
+	lock      sync.Mutex //The modules importing the structure are parsed at the same time
+}
+
+func GenericStructOf(params []string, template *Structure) *GenericStructure {
+	return &GenericStructure{params, template, make([]*Structure, 0), sync.Mutex{}}
+}
+
+func (nc *GenericStructure) Instance(args []OBJType) (OBJType, error) {
+	if len(args) != len(nc.Params) {
+		return nil, fmt.Errorf("Type %s expects %d type parameters", nc.Template.Name, len(nc.Params))
+	}
+	nc.lock.Lock()
+	defer nc.lock.Unlock()
+	for _, s := range nc.instances {
+		if sameTypes(s.Params, args) {
+			return s, nil
+		}
+	}
+	name := nc.Template.Name
+	for _, a := range args {
+		name += "|" + Repr(a)
+	}
+	items := substituteTypes(nc.Template.ItemTypes, args)
+	for _, item := range items {
+		if e := checkOptionals(item); e != nil {
+			return nil, e
+		}
+	}
+	s := StructOf(items, nc.Template.Fields, name, nc.Template.Owner).(*Structure)
+	s.Generic, s.Params = nc, args
+	nc.instances = append(nc.instances, s)
+	return s, nil
+}
+
+//Deduces the type arguments from the value casted into the structure
+func (nc *GenericStructure) Infer(from OBJType) (OBJType, error) {
+	fields := nc.Template.ItemTypes
+	items := from.FixedItems()
+	if (from.Primitive() != TUPLE && from.Primitive() != STRUCT) || len(items) < len(fields) {
+		return nil, fmt.Errorf("Can not cast %s into %s", Repr(from), nc.Template.Name)
+	}
+	args := make([]OBJType, len(nc.Params))
+	for i := range fields {
+		if !unifyTypes(fields[i], items[i], args) {
+			return nil, fmt.Errorf("Can not cast %s into %s", Repr(from), nc.Template.Name)
+		}
+	}
+	for i := range args {
+		if args[i] == nil {
+			return nil, fmt.Errorf("Can not infer type parameter %s of %s", nc.Params[i], nc.Template.Name)
+		}
+	}
+	return nc.Instance(args)
+}
+
+func (nc *GenericStructure) Module() Module {
+	return nc.Template.Owner
+}
+
+func (nc *GenericStructure) TypeName() string {
+	return nc.Template.Name
+}
+
+func (nc *GenericStructure) Primitive() PrimitiveType {
+	return GENERIC
+}
+
+func (nc *GenericStructure) Items() OBJType {
+	return nil
+}
+
+func (nc *GenericStructure) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *GenericStructure) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *GenericStructure) Create() ([]runtime.Instruction, error) {
+	return nil, fmt.Errorf("Type %s expects %d type parameters", nc.Template.Name, len(nc.Params))
+}
+
+//Functions a type must provide to be accepted where the interface is expected
+type Interface struct {
+	Requirements []Requirement
+	Name         string
+	Owner        Module
+}
+
+//Function of an interface, Self is the only type parameter
+type Requirement struct {
+	Name     string
+	Operator bool
+	Args     []OBJType
+	Return   OBJType //Nil when any return is valid
+}
+
+func InterfaceOf(name string, module Module) OBJType {
+	return &Interface{make([]Requirement, 0), name, module}
+}
+
+func (r Requirement) Repr(self OBJType) string {
+	kind := "fn"
+	if r.Operator {
+		kind = "op"
+	}
+	rep := fmt.Sprintf("%s %s", kind, r.Name)
+	for i, a := range r.Args {
+		if i == 0 {
+			rep += ": "
+		} else {
+			rep += ", "
+		}
+		rep += Repr(substituteType(a, []OBJType{self}))
+	}
+	if r.Return != nil {
+		rep += " -> " + Repr(substituteType(r.Return, []OBJType{self}))
+	}
+	return rep
+}
+
+func (nc *Interface) Module() Module {
+	return nc.Owner
+}
+
+func (nc *Interface) TypeName() string {
+	return nc.Name
+}
+
+func (nc *Interface) Primitive() PrimitiveType {
+	return INTERFACE
+}
+
+func (nc *Interface) Items() OBJType {
+	return nil
+}
+
+func (nc *Interface) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *Interface) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *Interface) Create() ([]runtime.Instruction, error) {
+	return nil, fmt.Errorf("Interface %s can only constrain template arguments", nc.Name)
+}
+
+//Replaces the type parameters by the arguments
+func substituteType(t OBJType, args []OBJType) OBJType {
+	switch v := t.(type) {
+	case *TypeParameter:
+		return args[v.Index]
+	case *Container:
+		return &Container{v.ContainerType, substituteType(v.ItemsType, args), v.Name, v.CreateInstruction}
+	case *Optional:
+		return OptOf(substituteType(v.ItemsType, args))
+	case *TaskType:
+		return TaskOf(substituteType(v.ResultType, args))
+	case *ChannelType:
+		return ChanOf(substituteType(v.ItemsType, args))
+	case *Tuple:
+		return TupleOf(substituteTypes(v.ItemTypes, args))
+	case *FunctionType:
+		return FunctionTypeOf(substituteTypes(v.args, args), substituteType(v.ret, args))
+	case *Structure:
+		if v.Generic != nil {
+			if s, e := v.Generic.Instance(substituteTypes(v.Params, args)); e == nil {
+				return s
+			}
+		}
+	}
+	return t
+}
+
+func substituteTypes(types []OBJType, args []OBJType) []OBJType {
+	res := make([]OBJType, len(types))
+	for i, t := range types {
+		res[i] = substituteType(t, args)
+	}
+	return res
+}
+
+//Binds the parameters found in pattern to the types at the same place in actual
+func unifyTypes(pattern, actual OBJType, args []OBJType) bool {
+	switch v := pattern.(type) {
+	case *TypeParameter:
+		if args[v.Index] == nil {
+			args[v.Index] = actual
+			return true
+		}
+		return CompareTypes(args[v.Index], actual)
+	case *Container:
+		return actual.Primitive() == v.ContainerType && unifyTypes(v.ItemsType, actual.Items(), args)
+	case *Optional:
+		return actual.Primitive() == NULL && unifyTypes(v.ItemsType, actual.Items(), args)
+	case *TaskType:
+		return actual.Primitive() == TASK && unifyTypes(v.ResultType, actual.Items(), args)
+	case *ChannelType:
+		return actual.Primitive() == CHANNEL && unifyTypes(v.ItemsType, actual.Items(), args)
+	case *Tuple:
+		return actual.Primitive() == TUPLE && unifyArrayOfTypes(v.ItemTypes, actual.FixedItems(), args)
+	case *FunctionType:
+		f, ok := actual.(*FunctionType)
+		return ok && unifyArrayOfTypes(v.args, f.args, args) && unifyTypes(v.ret, f.ret, args)
+	case *Structure:
+		if v.Generic != nil {
+			s, ok := actual.(*Structure)
+			return ok && s.Generic == v.Generic && unifyArrayOfTypes(v.Params, s.Params, args)
+		}
+	}
+	return CompareTypes(pattern, actual)
+}
+
+func unifyArrayOfTypes(patterns, actual []OBJType, args []OBJType) bool {
+	if len(patterns) != len(actual) {
+		return false
+	}
+	for i := range patterns {
+		if !unifyTypes(patterns[i], actual[i], args) {
+			return false
+		}
+	}
+	return true
+}
+
+//Exact equality, unlike CompareTypes Any only matches Any
+func sameTypes(a, b []OBJType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameType(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameType(a, b OBJType) bool {
+	if a.Primitive() != b.Primitive() || a.TypeName() != b.TypeName() || !a.Module().Is(b.Module()) {
+		return false
+	}
+	switch a.Primitive() {
+	case VECTOR, MAP, VARIADIC, NULL, TASK, CHANNEL:
+		return sameType(a.Items(), b.Items())
+	case TUPLE:
+		return sameTypes(a.FixedItems(), b.FixedItems())
+	case FUNCTION:
+		at, bt := a.(*FunctionType), b.(*FunctionType)
+		return sameTypes(at.args, bt.args) && sameType(at.ret, bt.ret)
+	}
+	return true
+}
+
 type FunctionType struct {
 	args []OBJType
 	ret  OBJType
@@ -395,3 +931,52 @@ func (nc *FunctionType) NamedItems() map[string]int {
 func (nc *FunctionType) Create() ([]runtime.Instruction, error) {
 	return nil, errors.New("Trying to instance a type with no default value")
 }
+
+//Tagged union, at runtime a vector with the variant name followed by its fields
+type Enum struct {
+	Variants []string
+	Fields   [][]OBJType
+	Name     string
+	Owner    Module
+}
+
+func EnumOf(name string, module Module) OBJType {
+	return &Enum{make([]string, 0), make([][]OBJType, 0), name, module}
+}
+
+func (nc *Enum) Variant(name string) (int, bool) {
+	for i, v := range nc.Variants {
+		if v == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (nc *Enum) Module() Module {
+	return nc.Owner
+}
+
+func (nc *Enum) TypeName() string {
+	return nc.Name
+}
+
+func (nc *Enum) Primitive() PrimitiveType {
+	return ENUM
+}
+
+func (nc *Enum) Items() OBJType {
+	return nil
+}
+
+func (nc *Enum) FixedItems() []OBJType {
+	return nil
+}
+
+func (nc *Enum) NamedItems() map[string]int {
+	return nil
+}
+
+func (nc *Enum) Create() ([]runtime.Instruction, error) {
+	return nil, fmt.Errorf("Enum %s must be created through one of its variants", nc.Name)
+}
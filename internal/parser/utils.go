@@ -18,7 +18,7 @@ func isNext(tks []Token) bool {
 }
 
 func next(tks []Token, t Token) bool {
-	return len(tks) > 0 && tks[0] == t
+	return len(tks) > 0 && tks[0].Is(t)
 }
 
 func nextT(tks []Token, t TokenType) bool {
@@ -29,34 +29,63 @@ func nextV(tks []Token, v string) bool {
 	return len(tks) > 0 && tks[0].Data == v
 }
 
+//Token missing when there were no more tokens to read, it is located at the end of the line of the block
+type missingToken struct {
+	err error
+}
+
+func (e *missingToken) Error() string {
+	return e.err.Error()
+}
+
+func (e *missingToken) Unwrap() error {
+	return e.err
+}
+
 func unexpect(tks []Token) error {
 	if len(tks) > 0 {
-		return fmt.Errorf("Unexpected token: %s of type %s", tks[0].Data, tks[0].Kind.Representation())
+		return ErrorAt(tks[0].Pos, fmt.Errorf("Unexpected token: %s of type %s", tks[0].Data, tks[0].Kind.Representation()))
 	} else {
 		return nil
 	}
 }
 
 func expect(tks []Token, t Token) ([]Token, error) {
-	if len(tks) == 0 || tks[0] != t {
-		return nil, fmt.Errorf("Expecting token: %s", t.Data)
+	if len(tks) == 0 {
+		return nil, &missingToken{fmt.Errorf("Expecting token: %s", t.Data)}
+	}
+	if !tks[0].Is(t) {
+		return nil, ErrorAt(tks[0].Pos, fmt.Errorf("Expecting token: %s", t.Data))
 	}
 	return tks[1:], nil
 }
 
 func expectT(tks []Token, t TokenType) (Token, []Token, error) {
 	if len(tks) == 0 {
-		return Token{}, nil, fmt.Errorf("Expecting token type %s", t.Representation())
+		return Token{}, nil, &missingToken{fmt.Errorf("Expecting token type %s", t.Representation())}
 	}
 	if tks[0].Kind != t {
-		return Token{}, nil, fmt.Errorf("Expecting token type %s instead of %s", t.Representation(), tks[0].Kind.Representation())
+		return Token{}, nil, ErrorAt(tks[0].Pos,
+			fmt.Errorf("Expecting token type %s instead of %s", t.Representation(), tks[0].Kind.Representation()))
 	}
 	return tks[0], tks[1:], nil
 }
 
+//The rest of a line that opens a block must be only the token do
+func expectBlockOpening(tks []Token) error {
+	tail, e := expect(tks, DO)
+	if e != nil {
+		return e
+	}
+	return unexpect(tail)
+}
+
 func expectV(tks []Token, v string) (Token, []Token, error) {
-	if len(tks) == 0 || tks[0].Data != v {
-		return Token{}, nil, fmt.Errorf("Expecting token: %s", v)
+	if len(tks) == 0 {
+		return Token{}, nil, &missingToken{fmt.Errorf("Expecting token: %s", v)}
+	}
+	if tks[0].Data != v {
+		return Token{}, nil, ErrorAt(tks[0].Pos, fmt.Errorf("Expecting token: %s", v))
 	}
 	return tks[0], tks[1:], nil
 }
@@ -79,9 +108,9 @@ func splitByToken(data []Token, key func(Token) bool, pairs []struct {
 mainloop:
 	for i, tk := range data {
 		if opened_idx >= 0 {
-			if pairs[opened_idx].close == tk {
+			if pairs[opened_idx].close.Is(tk) {
 				opened_level--
-			} else if pairs[opened_idx].open == tk {
+			} else if pairs[opened_idx].open.Is(tk) {
 				opened_level++
 			}
 			if opened_level == 0 {
@@ -90,7 +119,7 @@ mainloop:
 			current = append(current, tk)
 		} else {
 			for i, p := range pairs {
-				if p.open == tk {
+				if p.open.Is(tk) {
 					opened_idx = i
 					opened_level = 1
 					current = append(current, tk)
@@ -99,7 +128,7 @@ mainloop:
 			}
 			if key(tk) {
 				if (!allowvoid && len(current) == 0) || (!lastsplit && i == len(data)-1) {
-					return nil, fmt.Errorf("Unexpected token %s", tk.Data)
+					return nil, ErrorAt(tk.Pos, fmt.Errorf("Unexpected token %s", tk.Data))
 				}
 				res = append(res, current)
 				if includekey {
@@ -140,11 +169,11 @@ func blockSubtract(data []Token, open, close Token, pairs []struct {
 	for _, tk := range data {
 		switch stage {
 		case 0:
-			if tk == open {
+			if tk.Is(open) {
 				stage = 1
 			} else {
 				for _, p := range pairs {
-					if p.open == tk {
+					if p.open.Is(tk) {
 						left = data
 						return //Block is inside pairs
 					}
@@ -153,9 +182,9 @@ func blockSubtract(data []Token, open, close Token, pairs []struct {
 			}
 		case 1:
 			if opened_idx >= 0 {
-				if pairs[opened_idx].close == tk {
+				if pairs[opened_idx].close.Is(tk) {
 					opened_level--
-				} else if pairs[opened_idx].open == tk {
+				} else if pairs[opened_idx].open.Is(tk) {
 					opened_level++
 				}
 				if opened_level == 0 {
@@ -163,11 +192,11 @@ func blockSubtract(data []Token, open, close Token, pairs []struct {
 				}
 				inner = append(inner, tk)
 			} else {
-				if tk == close {
+				if tk.Is(close) {
 					stage = 2
 				} else {
 					for i, p := range pairs {
-						if p.open == tk {
+						if p.open.Is(tk) {
 							opened_idx = i
 							opened_level = 1
 						}
@@ -187,7 +216,7 @@ func blockSubtract(data []Token, open, close Token, pairs []struct {
 
 func readUntilToken(data []Token, key Token) ([]Token, []Token) {
 	for i := range data {
-		if data[i] == key {
+		if data[i].Is(key) {
 			return data[:i], data[i:]
 		}
 	}
@@ -199,7 +228,7 @@ returns -1 if the token is not found, the index otherwise
 */
 func indexOfFirstToken(data []Token, tk Token) int {
 	for i := range data {
-		if data[i] == tk {
+		if data[i].Is(tk) {
 			return i
 		}
 	}
@@ -0,0 +1,230 @@
+package runtime
+
+import (
+	"errors"
+	"sync"
+)
+
+//Every channel of the machine shares the lock, so select can wait for several of them at once
+type channelHub struct {
+	lock    sync.Mutex
+	changed *sync.Cond
+}
+
+//Queue of values, a sender of an unbuffered channel waits until its value is taken
+type Channel struct {
+	items     []Object
+	capacity  int
+	closed    bool
+	sent      int //Values ever sent, numbers the senders
+	taken     int //Values ever received or taken back by their sender
+	receivers int //Processes blocked receiving from it
+	machine   *VM
+}
+
+func NewChannel(vm *VM, capacity int) *Channel {
+	return &Channel{make([]Object, 0), capacity, false, 0, 0, 0, vm}
+}
+
+//The lock must be held, wakes the processes waiting on the channels of the machine
+func (c *Channel) changed() {
+	c.machine.stateChanged()
+	c.machine.channels.changed.Broadcast()
+}
+
+//Unbuffered channels hold the value of one sender
+func (c *Channel) room() bool {
+	return len(c.items) < c.capacity || len(c.items) == 0
+}
+
+//The lock must be held, whether a value sent now is taken without waiting for a receiver to come
+func (c *Channel) ready() bool {
+	return len(c.items) < c.capacity || len(c.items) == 0 && c.receivers > 0
+}
+
+//The lock must be held, returns the number of the sender or 0 if there is no room
+func (c *Channel) put(v Object) int {
+	if c.closed {
+		panic(errors.New("Send on closed channel"))
+	}
+	if !c.room() {
+		return 0
+	}
+	c.items = append(c.items, v)
+	c.sent++
+	c.changed()
+	return c.sent
+}
+
+//The lock must be held, whether the sender may leave
+func (c *Channel) delivered(ticket int) bool {
+	return c.capacity > 0 || c.taken >= ticket
+}
+
+//The lock must be held, takes back the value of an unbuffered sender that nobody received
+func (c *Channel) retract(ticket int) {
+	if c.taken+1 != ticket {
+		panic(errors.New("Unexpected situation, retracting a value not at the front of the channel"))
+	}
+	c.items = c.items[1:]
+	c.taken++
+	c.changed()
+}
+
+//The lock must be held, counts the receivers waiting on the channel
+func (c *Channel) park(n int) {
+	c.receivers += n
+	c.changed()
+}
+
+//The lock must be held, none if the channel is closed, false if there is nothing to receive yet
+func (c *Channel) take() (Object, bool) {
+	if len(c.items) > 0 {
+		v := c.items[0]
+		c.items = c.items[1:]
+		c.taken++
+		c.changed()
+		return v, true
+	}
+	if c.closed {
+		return Null{}, true
+	}
+	return nil, false
+}
+
+func (proc *Process) send(c *Channel, v Object) {
+	ticket := 0
+	proc.wait(c.machine.channels.changed, func() bool {
+		if ticket == 0 {
+			ticket = c.put(v)
+		}
+		return ticket != 0 && c.delivered(ticket)
+	})
+}
+
+func (proc *Process) receive(c *Channel) (v Object) {
+	parked := false
+	defer func() {
+		//Cancelled while waiting
+		if parked {
+			c.machine.channels.lock.Lock()
+			c.park(-1)
+			c.machine.channels.lock.Unlock()
+		}
+	}()
+	proc.wait(c.machine.channels.changed, func() (ok bool) {
+		v, ok = c.take()
+		if !ok && !parked {
+			parked = true
+			c.park(1)
+		} else if ok && parked {
+			parked = false
+			c.park(-1)
+		}
+		return
+	})
+	return
+}
+
+func tryReceive(c *Channel) Object {
+	c.machine.channels.lock.Lock()
+	defer c.machine.channels.lock.Unlock()
+	if v, ok := c.take(); ok {
+		return v
+	}
+	return Null{}
+}
+
+func closeChannel(c *Channel) {
+	c.machine.channels.lock.Lock()
+	defer c.machine.channels.lock.Unlock()
+	if c.closed {
+		panic(errors.New("Close of closed channel"))
+	}
+	c.closed = true
+	c.changed()
+}
+
+//Cases are popped in reverse, a channel for receiving or a channel and a value for sending.
+//A send case is only taken when its value is received at once, so the fallback is taken otherwise
+func (proc *Process) selectChannels(fstack *FunctionStack, sends []bool, fallback bool) (Object, int) {
+	channels := make([]*Channel, len(sends))
+	values := make([]Object, len(sends))
+	for i := len(sends) - 1; i >= 0; i-- {
+		if sends[i] {
+			values[i] = fstack.Pop()
+		}
+		channels[i] = fstack.Pop().(*Channel)
+	}
+	//The receive cases wait as receivers, but not on the channels it sends to as it can not receive from itself
+	listening := make([]*Channel, 0, len(sends))
+	for i, c := range channels {
+		if !sends[i] && !sendsTo(channels, sends, c) {
+			listening = append(listening, c)
+		}
+	}
+	parked := false
+	unpark := func() {
+		if parked {
+			for _, c := range listening {
+				c.park(-1)
+			}
+			parked = false
+		}
+	}
+	defer func() {
+		//Cancelled while waiting
+		proc.machine.channels.lock.Lock()
+		unpark()
+		proc.machine.channels.lock.Unlock()
+	}()
+	var received Object = Null{}
+	chosen, ticket := -1, 0
+	proc.wait(proc.machine.channels.changed, func() bool {
+		if chosen >= 0 {
+			c := channels[chosen]
+			if c.delivered(ticket) {
+				return true
+			}
+			if c.receivers > 0 {
+				return false
+			}
+			//The receiver went away without the value
+			c.retract(ticket)
+			chosen = -1
+		}
+		for i, c := range channels {
+			if sends[i] {
+				if c.closed || c.ready() {
+					unpark()
+					ticket, chosen = c.put(values[i]), i
+					return c.delivered(ticket)
+				}
+			} else if v, ok := c.take(); ok {
+				received, chosen = v, i
+				return true
+			}
+		}
+		if fallback {
+			chosen = len(sends)
+			return true
+		}
+		if !parked {
+			for _, c := range listening {
+				c.park(1)
+			}
+			parked = true
+		}
+		return false
+	})
+	return received, chosen
+}
+
+func sendsTo(channels []*Channel, sends []bool, c *Channel) bool {
+	for i := range channels {
+		if sends[i] && channels[i] == c {
+			return true
+		}
+	}
+	return false
+}
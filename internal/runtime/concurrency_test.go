@@ -0,0 +1,489 @@
+package runtime_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+//Runs the program with a goroutine per process and then in turns with a few seeds
+func runEverywhere(t *testing.T, src, want string) {
+	t.Helper()
+	want = bsttest.Source(want)
+	setups := map[string]func(vm *runtime.VM){"goroutines": nil}
+	for seed := int64(0); seed < 3; seed++ {
+		setups[fmt.Sprintf("scheduled seed %d", seed)] = bsttest.Scheduled(2, seed)
+	}
+	for name, setup := range setups {
+		out, err := bsttest.Run(t, src, setup)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if out != want {
+			t.Fatalf("%s: got:\n%s\nExpecting:\n%s", name, out, want)
+		}
+	}
+}
+
+func TestChannels(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn produce: ch Chan|Int, n Int do
+		    var i = 0
+		    while i < n do
+		        send: ch, i
+		        i = i + 1
+		    close: ch
+
+		fn square: input Chan|Int, output Chan|Int do
+		    var running = true
+		    while running do
+		        if val x = receive(input) do
+		            send: output, x * x
+		        else do
+		            running = false
+		    close: output
+
+		fn main: args Vec|Str do
+		    val a = [Chan|Int]
+		    val b = buffered: [Chan|Int], 2
+		    produce: a, 5 spawn
+		    square: a, b spawn
+		    var total = 0
+		    var open = true
+		    while open do
+		        if val x = receive(b) do
+		            total = total + x
+		        else do
+		            open = false
+		    print: "total ", total
+		    print: try_receive(b)
+	`, `
+		total 30
+		none
+	`)
+}
+
+func TestSelect(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn main: args Vec|Str do
+		    val c = buffered: [Chan|Str], 1
+		    val d = [Chan|Int]
+		    select do
+		        x in d do
+		            print: "from d ", x
+		        c <- "hi" do
+		            print: "sent to c"
+		    select do
+		        x in d do
+		            print: "from d ", x
+		        s in c do
+		            print: "from c ", s
+		    select do
+		        x in d do
+		            print: "from d ", x
+		        else do
+		            print: "nothing ready"
+		    close: d
+		    select do
+		        x in d do
+		            print: "closed d gives ", x
+	`, `
+		sent to c
+		from c hi
+		nothing ready
+		closed d gives none
+	`)
+}
+
+//A send case is only taken when there is room or a receiver waiting, otherwise the fallback is
+func TestSelectSendFallback(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn taker: ch Chan|Int do
+		    print: "took ", unwrap(receive(ch))
+
+		fn chooser: a Chan|Int, b Chan|Int do
+		    select do
+		        x in a do
+		            print: "a gave ", x
+		        y in b do
+		            print: "b gave ", y
+
+		fn main: args Vec|Str do
+		    val ch = [Chan|Int]
+		    select do
+		        ch <- 1 do
+		            print: "sent"
+		        else do
+		            print: "nobody receiving"
+		    val b = buffered: [Chan|Int], 1
+		    select do
+		        b <- 2 do
+		            print: "buffered"
+		        else do
+		            print: "full"
+		    select do
+		        b <- 3 do
+		            print: "buffered"
+		        else do
+		            print: "full"
+		    val t = taker: ch spawn
+		    var sent = false
+		    while !sent do
+		        select do
+		            ch <- 4 do
+		                sent = true
+		            else do
+		                sleep: 1
+		    join: t
+		    val x = [Chan|Int]
+		    val y = [Chan|Int]
+		    val c = chooser: x, y spawn
+		    select do
+		        y <- 5 do
+		            join: c
+		            print: "sent to chooser"
+	`, `
+		nobody receiving
+		buffered
+		full
+		took 4
+		b gave 5
+		sent to chooser
+	`)
+}
+
+func TestMailboxes(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn echo: owner Pid do
+		    var running = true
+		    while running do
+		        receive do
+		            {:ping, n} do
+		                send: owner, {:pong, n}
+		            :stop do
+		                running = false
+
+		fn main: args Vec|Str do
+		    val e = echo: self() spawn
+		    send: e, :hello
+		    send: e, {:ping, 1}
+		    send: e, {:ping, 2}
+		    receive do
+		        {:pong, n} do
+		            print: "pong ", n
+		    receive do
+		        {:pong, n} do
+		            print: "pong ", n
+		    send: e, :stop
+		    join: e
+		    print: "done"
+	`, `
+		pong 1
+		pong 2
+		done
+	`)
+}
+
+//Values of Any are checked when run, so a process sent in a message can be replied to
+func TestMailboxReplyToSender(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn server do
+		    var running = true
+		    while running do
+		        receive do
+		            {:ping, (from)Pid} do
+		                send: from, {:pong, self()}
+		            {:add, (a)Int, (b)Int, (from)Pid} do
+		                send: from, a + b
+		            :stop do
+		                running = false
+
+		fn kind: a Any do
+		    match a do
+		        (x)Int do
+		            print: "int ", x + 1
+		        (x)Dec do
+		            print: "dec ", x
+		        _ do
+		            print: "other"
+
+		fn cast: a Any do
+		    print: (a)Pid
+
+		fn main: args Vec|Str do
+		    val s = server: spawn
+		    send: s, {:ping, self()}
+		    receive do
+		        {:pong, who} do
+		            val p = (who)Pid
+		            print: "pong from ", p
+		            send: p, {:add, 2, 3, self()}
+		    receive do
+		        (n)Int do
+		            print: "sum ", n
+		    send: s, :stop
+		    join: s
+		    print: self()
+		    kind: 1.5
+		    kind: 2
+		    kind: {1, 2}
+		    rescue e RuntimeError do
+		        print: "error: ", e.message
+		    cast: "text"
+	`, `
+		pong from <process 2>
+		sum 5
+		<process 1>
+		dec 1.5
+		int 3
+		other
+		error: Can not cast text into Pid
+	`)
+}
+
+func TestLinksAndMonitors(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		struct Bad: code Int
+
+		fn crasher: n Int do
+		    if n > 0 do
+		        throw {n}Bad
+		    return n
+
+		fn quiet: n Int do
+		    return n
+
+		fn main: args Vec|Str do
+		    val c = crasher: 4 spawn
+		    link: c
+		    receive do
+		        {:exit, _, reason} do
+		            if val {code} = reason do
+		                print: "linked child crashed with ", code
+		    val q = quiet: 1 spawn
+		    monitor: q
+		    receive do
+		        {:exit, _, reason} do
+		            print: "monitored child ended: ", reason
+	`, `
+		linked child crashed with 4
+		monitored child ended: normal
+	`)
+}
+
+func TestTasks(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		struct Boom: code Int
+
+		fn work: n Int do
+		    var acc = 0
+		    var i = 0
+		    while i < n do
+		        acc = acc + i
+		        i = i + 1
+		    return acc
+
+		fn fail: n Int do
+		    if n > 0 do
+		        throw {n}Boom
+		    return n
+
+		fn forever: n Int do
+		    var i = 0
+		    while true do
+		        i = i + 1
+		    return i
+
+		fn main: args Vec|Str do
+		    val t = work: 1000 spawn
+		    print: join(t)
+		    val ft = fail: 3 spawn
+		    do
+		        rescue e Boom do
+		            print: "child failed with ", e.code
+		        join: ft
+		    val f = forever: 1 spawn
+		    cancel: f
+		    rescue e RuntimeError do
+		        print: "cancelled: ", e.message
+		    print: join(f)
+	`, `
+		499500
+		child failed with 3
+		cancelled: Task cancelled
+	`)
+}
+
+//A process joining a task still sees its deadline and its cancellation
+func TestJoinIsInterrupted(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn forever do
+		    while true do
+		        sleep: 1
+
+		fn waiter do
+		    val t = forever: spawn
+		    join: t
+
+		fn main: args Vec|Str do
+		    do
+		        rescue e TimeoutError do
+		            print: "timeout: ", e.message
+		        with_timeout: 50, fn waiter: {}
+		    val w = waiter: spawn
+		    sleep: 10
+		    cancel: w
+		    rescue e RuntimeError do
+		        print: "cancelled: ", e.message
+		    join: w
+	`, `
+		timeout: Timed out after 50 ms
+		cancelled: Task cancelled
+	`)
+}
+
+//Once the context of the wait is done, the tasks spawned by the main process are cancelled as well
+func TestWaitCancelsEveryProcess(t *testing.T) {
+	symbols, cname, err := bsttest.Compile(t, `
+		import "../std"
+
+		fn forever do
+		    while true do
+		        sleep: 1
+
+		fn main: args Vec|Str do
+		    forever: spawn
+		    forever: spawn
+		    forever:
+	`)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+	vm := runtime.NewVM()
+	vm.LoadSymbols(symbols)
+	var ended int32
+	vm.AddEndHook(func(proc *runtime.Process) {
+		atomic.AddInt32(&ended, 1)
+	})
+	process, err := vm.InitSpawn(context.Background(), cname, []runtime.Object{runtime.MakeVec()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		//Once the tasks are spawned
+		for end := time.Now().Add(time.Second); len(vm.Processes()) < 3 && time.Now().Before(end); {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+	if err := vm.Wait(ctx, process); err != context.Canceled {
+		t.Fatalf("Expecting the error of the context, got %v", err)
+	}
+	for end := time.Now().Add(time.Second); atomic.LoadInt32(&ended) < 3; time.Sleep(time.Millisecond) {
+		if time.Now().After(end) {
+			t.Fatalf("Only %d of the 3 processes ended", atomic.LoadInt32(&ended))
+		}
+	}
+}
+
+func TestTimers(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn slow do
+		    sleep: 500
+		    print: "slow finished"
+
+		fn quick do
+		    sleep: 10
+		    return 5
+
+		fn spin do
+		    var i = 0
+		    while true do
+		        i = i + 1
+
+		fn main: args Vec|Str do
+		    val t0 = clock:
+		    sleep: 20
+		    print: "slept ", (clock() - t0) >= 20000
+		    print: "quick ", with_timeout(1000, fn quick: {})
+		    do
+		        rescue e TimeoutError do
+		            print: "timeout: ", e.message
+		        with_timeout: 20, fn slow: {}
+		    do
+		        rescue e TimeoutError do
+		            print: "spin timeout: ", e.message
+		        with_timeout: 20, fn spin: {}
+	`, `
+		slept 1
+		quick 5
+		timeout: Timed out after 20 ms
+		spin timeout: Timed out after 20 ms
+	`)
+}
+
+func TestSyncTypes(t *testing.T) {
+	runEverywhere(t, `
+		import "../std"
+
+		fn bump: m Mutex, counter Vec|Int, group WaitGroup, hits AtomicInt do
+		    var i = 0
+		    while i < 200 do
+		        lock: m
+		        counter[0] = counter[0] + 1
+		        unlock: m
+		        add: hits, 1
+		        i = i + 1
+		    done: group
+
+		fn main: args Vec|Str do
+		    val m = [Mutex]
+		    val group = [WaitGroup]
+		    val hits = [AtomicInt]
+		    val counter = [Vec|Int]
+		    0 -> counter
+		    add: group, 4
+		    bump: m, counter, group, hits spawn
+		    bump: m, counter, group, hits spawn
+		    bump: m, counter, group, hits spawn
+		    bump: m, counter, group, hits spawn
+		    wait: group
+		    print: "counter ", counter[0], " hits ", load(hits)
+		    print: try_lock(m), try_lock(m)
+		    unlock: m
+		    store: hits, 7
+		    print: compare_and_swap(hits, 7, 9), compare_and_swap(hits, 7, 1), load(hits)
+		    rescue e do
+		        print: "error: ", e
+		    unlock: m
+	`, `
+		counter 800 hits 800
+		01
+		017
+		error: Unlocking a mutex that is not locked
+	`)
+}
@@ -1,22 +1,33 @@
 package runtime
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 )
 
 type PID *Process
 
 type RescuePoint struct {
-	fragment  string
+	symbol    *Symbol
+	pc        int //Handler, inside the same function that set up the rescue
 	stack     int
 	callstack int
-	exported  int
+	kind      string //Type of the errors rescued, empty rescues any error as a message
+	deadlines int    //Deadlines started when it was set up
 }
 
 type VM struct {
-	symbols  map[string]*Symbol //Loaded instructions
-	embedded map[string]EmbeddedFunction
+	symbols    map[string]*Symbol //Loaded instructions
+	embedded   map[string]EmbeddedFunction
+	scheduler  *Scheduler //Nil when every process runs on its own goroutine
+	structured bool       //Processes wait for the tasks they spawn
+	hooks      []Hook
+	endHooks   []Hook
+	registry   registry
+	channels   channelHub
 }
 
 type Process struct {
@@ -25,23 +36,47 @@ type Process struct {
 	pc            int //Current instruction
 	symbol        *Symbol
 	functionstack *FunctionStack //Function stack
-	done          chan error     //Is Process done?
+	done          chan struct{}  //Closed once the process is done
+	ended         *sync.Cond     //Broadcast when done is closed, for the processes joining it
 	callstack     *CallStack
 	env           *Environment
 	locals        *Locals
 	rescues       []RescuePoint
+	result        Object     //Value returned by the process
+	failure       *Exception //Uncaught exception that ended the process
+	err           error
+	cancelled     int32
+	mailbox       *Mailbox
+	watchers      watchers
+	turn          chan struct{} //Receives the turn from the scheduler
+	steps         int           //Instructions run in the current turn
+	stalledAt     uint64        //Generation of the changes when the process blocked plus one, zero if it is not blocked
+	family        family
+	interrupted   int32 //Set when a child failed and its failure is still to be thrown
+	ctx           context.Context
+	deadlines     []*deadline
+	expired       int32 //Set when a deadline passed
+	waitlock      sync.Mutex
+	waiting       *sync.Cond //Condition the process is waiting for, if any
+	handling      *Exception //Last exception rescued
+	id            int
 }
 
+//Ends a cancelled process, it can not be rescued
+var errCancelled = errors.New("Task cancelled")
+
 /*
 VM Zone
 */
 
 func NewVM() *VM {
-	vm := &VM{make(map[string]*Symbol), make(map[string]EmbeddedFunction)}
+	vm := &VM{make(map[string]*Symbol), make(map[string]EmbeddedFunction), nil, false,
+		nil, nil, registry{processes: make(map[int]*Process)}, channelHub{}}
+	vm.channels.changed = sync.NewCond(&vm.channels.lock)
 	return vm
 }
 
-func (vm *VM) spawn(parent PID, fr string, stack *FunctionStack) (PID, error) {
+func (vm *VM) spawn(ctx context.Context, parent PID, fr string, stack *FunctionStack) (PID, error) {
 	sym, ex := vm.symbols[fr]
 	if !ex {
 		return nil, fmt.Errorf("Symbol %s not found", fr)
@@ -50,32 +85,52 @@ func (vm *VM) spawn(parent PID, fr string, stack *FunctionStack) (PID, error) {
 	env, locals := callstack.GetAvailableItems()
 	env.ForCall(stack, sym.Args)
 	process := &Process{vm, parent, 0, sym, NewFunctionStack(10000),
-		make(chan error), callstack, env, locals, make([]RescuePoint, 0)}
+		make(chan struct{}), sync.NewCond(&sync.Mutex{}), callstack, env, locals, make([]RescuePoint, 0), nil, nil, nil, 0,
+		NewMailbox(vm), watchers{}, make(chan struct{}, 1), 0, 0, family{}, 0,
+		ctx, make([]*deadline, 0), 0, sync.Mutex{}, nil, nil, 0}
+	vm.register(process)
+	if vm.scheduler != nil {
+		vm.scheduler.enter(process)
+	}
+	if vm.structured && parent != nil {
+		asTask(parent).adopt(process)
+	}
+	if ctx.Done() != nil {
+		go process.cancelWhenDone()
+	}
 	go process.launch()
 	return process, nil
 }
 
 func (vm *VM) Spawn(fr string) (PID, error) {
-	return vm.spawn(nil, fr, NewFunctionStack(0))
+	return vm.spawn(context.Background(), nil, fr, NewFunctionStack(0))
 }
 
-func (vm *VM) InitSpawn(fr string, stack []Object) (PID, error) {
+//Every process spawned from the root one is cancelled once the context is done
+func (vm *VM) InitSpawn(ctx context.Context, fr string, stack []Object) (PID, error) {
 	fs := NewFunctionStack(uint(len(stack)))
 	if stack != nil {
 		for _, o := range stack {
 			fs.Push(o)
 		}
 	}
-	return vm.spawn(nil, fr, fs)
+	return vm.spawn(ctx, nil, fr, fs)
 }
 
-func (vm *VM) Wait(process PID) error {
-	e, on := <-process.done
-	if on {
-		close(process.done)
-		return e
-	} else {
-		return errors.New("Process already closed")
+//If the context is done first every process of the machine is cancelled and the error of the context returned
+func (vm *VM) Wait(ctx context.Context, process PID) error {
+	select {
+	case <-process.done:
+		//Processes left blocked after the process ended do not matter
+		if s := vm.scheduler; s != nil && process.err != nil {
+			if err, ok := s.failure.Load().(error); ok {
+				return err
+			}
+		}
+		return process.err
+	case <-ctx.Done():
+		vm.cancelAll()
+		return ctx.Err()
 	}
 }
 
@@ -106,7 +161,7 @@ Process Zone
 */
 
 func (proc *Process) Spawn(fr string) PID {
-	child, err := proc.machine.spawn(proc, fr, proc.functionstack.Clone())
+	child, err := proc.machine.spawn(proc.ctx, proc, fr, proc.functionstack.Clone())
 	if err != nil {
 		panic(err)
 	}
@@ -114,12 +169,18 @@ func (proc *Process) Spawn(fr string) PID {
 }
 
 func (proc *Process) ReturnLastPoint() {
+	if proc.machine.structured {
+		proc.awaitChildren(proc.callstack.idx)
+	}
 	point := proc.callstack.Top()
 	if point == nil {
 		/*
 			If not element at the stack
 			Returning will force process to end
 		*/
+		if proc.functionstack.index > 0 {
+			proc.result = proc.functionstack.Pop()
+		}
 		proc.pc = len(proc.symbol.Source) + 1
 	} else {
 		proc.callstack.Pop()
@@ -158,7 +219,12 @@ func (proc *Process) DirectInvoke(fn EmbeddedFunction) {
 	for i := 0; i < fn.ArgCount; i++ {
 		args[i] = proc.functionstack.Pop()
 	}
-	r := fn.Function(args)
+	var r Object
+	if fn.Blocking != nil {
+		r = fn.Blocking(proc, args)
+	} else {
+		r = fn.Function(args)
+	}
 	if fn.Returns {
 		proc.functionstack.Push(r)
 	}
@@ -179,11 +245,44 @@ func compareFloat(flags int, a float64, b float64) int {
 	return boolNum((flags&1 != 0 && a == b) || (flags&2 != 0 && a < b)) ^ (flags >> 2)
 }
 
+//Only primitive objects are compared by value, containers never match
+func equalObjects(a Object, b Object) int {
+	switch a.(type) {
+	case int, float64, string, Null:
+		return boolNum(a == b)
+	}
+	return 0
+}
+
+func sizedVec(o Object, size int) int {
+	v, ok := o.(VecT)
+	return boolNum(ok && len(*v) == size)
+}
+
+//Atoms are strings and booleans are integers when run, so they pass as Str and Int
+func isKind(o Object, kind string) bool {
+	switch o.(type) {
+	case int:
+		return kind == "Int"
+	case float64:
+		return kind == "Dec"
+	case string:
+		return kind == "Str"
+	case PID:
+		return kind == "Pid"
+	}
+	return false
+}
+
 /*
 Run zone
 */
 
 func (proc *Process) launch() {
+	if s := proc.machine.scheduler; s != nil {
+		<-proc.turn
+		defer s.leave(proc)
+	}
 	for {
 		proc.run()
 		if proc.symbol == nil {
@@ -192,36 +291,109 @@ func (proc *Process) launch() {
 	}
 }
 
-func (proc *Process) rescueFor(e interface{}) {
-	rescue := proc.rescues[len(proc.rescues)-1]
-	proc.rescues = proc.rescues[0 : len(proc.rescues)-1]
+//Unwinds to the innermost rescue point matching the error, false if there is none
+func (proc *Process) rescueFor(ex Exception) bool {
+	var rescue RescuePoint
+	for {
+		if len(proc.rescues) == 0 {
+			return false
+		}
+		rescue = proc.rescues[len(proc.rescues)-1]
+		proc.rescues = proc.rescues[0 : len(proc.rescues)-1]
+		if rescue.kind == "" || rescue.kind == AnyException || rescue.kind == ex.Type {
+			break
+		}
+	}
+	proc.stopDeadlines(rescue.deadlines)
+	if proc.machine.structured {
+		proc.dropChildren(rescue.callstack)
+	}
 	proc.functionstack.index = rescue.stack
 	proc.callstack.idx = rescue.callstack
 	proc.env, proc.locals = proc.callstack.GetAvailableItems()
-	if rescue.exported >= 0 {
-		v := rescue.exported & 128
-		if v == 0 {
-			proc.functionstack.Push(proc.env.GetEnvironment(rescue.exported))
-		} else {
-			proc.functionstack.Push(proc.locals.GetLocal(rescue.exported & 127))
-		}
+	switch rescue.kind {
+	case "":
+		proc.functionstack.Push(ex.String())
+	case AnyException:
+		proc.functionstack.Push(ex)
+	default:
+		proc.functionstack.Push(ex.Value)
 	}
-	proc.functionstack.Push(fmt.Sprintf("%v", e))
-	proc.JumpToFragment(rescue.fragment)
+	proc.symbol = rescue.symbol
+	proc.pc = rescue.pc
+	proc.handling = &ex
+	return true
 }
 
 func (proc *Process) onEnd() {
 	if e := recover(); e != nil {
-		if len(proc.rescues) == 0 {
-			proc.done <- fmt.Errorf("[fr : %s, pc : %d, icode : %d] Runtime error: %v",
-				proc.symbol.Name, proc.pc-1, proc.symbol.Source[proc.pc-1].Code, e)
+		ex := AsException(e)
+		if ex.Trace == nil {
+			ex.Trace = proc.trace()
+		}
+		if e == errCancelled || !proc.rescueFor(ex) {
+			proc.failure = &ex
+			proc.err = &ProcessError{ex}
 			proc.symbol = nil
-		} else {
-			proc.rescueFor(e)
+			proc.stopDeadlines(0)
+			proc.machine.unregister(proc)
+			proc.finish()
+			proc.notifyEnd(ex.Value, true)
+			if proc.machine.structured {
+				proc.cancelChildren(nil)
+				if proc.parent != nil && e != errCancelled {
+					asTask(proc.parent).childFailed(proc)
+				}
+			}
 		}
 	} else {
-		proc.done <- nil
 		proc.symbol = nil
+		proc.stopDeadlines(0)
+		proc.machine.unregister(proc)
+		proc.finish()
+		proc.notifyEnd("normal", false)
+	}
+}
+
+//Closes done and wakes the processes joining it
+func (proc *Process) finish() {
+	proc.ended.L.Lock()
+	close(proc.done)
+	proc.ended.Broadcast()
+	proc.ended.L.Unlock()
+}
+
+//Waits for the task to end, the signals of the process such as a cancellation or a deadline interrupt it
+func (proc *Process) await(task *Process) {
+	proc.wait(task.ended, task.finished)
+}
+
+//Waits for the task, its uncaught exception is thrown again in the joiner
+func (proc *Process) join(task *Process) Object {
+	proc.await(task)
+	if task.failure != nil {
+		proc.observed(task)
+		proc.checkSignals()
+		panic(rethrown(task))
+	}
+	return task.result
+}
+
+//Failure of the task thrown again in another process, it gets the trace of the new one
+func rethrown(task *Process) Exception {
+	return Exception{task.failure.Type, task.failure.Value, nil, task.failure}
+}
+
+func asTask(o Object) *Process {
+	return (*Process)(o.(PID))
+}
+
+func (proc *Process) finished() bool {
+	select {
+	case <-proc.done:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -229,8 +401,20 @@ func (proc *Process) run() {
 	defer proc.onEnd()
 	fstack := proc.functionstack
 	for proc.pc < len(proc.symbol.Source) {
+		if atomic.LoadInt32(&proc.cancelled) != 0 {
+			panic(errCancelled)
+		}
+		if atomic.LoadInt32(&proc.expired) != 0 {
+			proc.checkTimeout()
+		}
+		if proc.machine.scheduler != nil {
+			proc.tick()
+		}
 		ins := proc.symbol.Source[proc.pc]
 		proc.pc++
+		for _, hook := range proc.machine.hooks {
+			hook(proc)
+		}
 		code := ins.Code
 		switch code {
 		case NOP:
@@ -307,19 +491,23 @@ func (proc *Process) run() {
 		case CLL, CLX:
 			proc.callstack.Insert(proc.pc, proc.symbol)
 			proc.env, proc.locals = proc.callstack.GetAvailableItems()
-			name := fstack.a(ins).(string)
+			fn := fstack.a(ins)
 			if code == CLX {
 				fstack.PushN(*fstack.b(ins).(VecT))
 			}
-			proc.JumpToFragment(name)
+			proc.JumpToFragment(fstack.target(fn))
 		case CLT:
-			proc.machine.spawn(proc, fstack.a(ins).(string), fstack)
+			child, err := proc.machine.spawn(proc.ctx, proc, fstack.target(fstack.a(ins)), fstack)
+			if err != nil {
+				panic(err)
+			}
+			fstack.Push(child)
 		case JMP, JMX:
-			name := fstack.a(ins).(string)
-			if code == CLX {
+			fn := fstack.a(ins)
+			if code == JMX {
 				fstack.PushN(*fstack.b(ins).(VecT))
 			}
-			proc.JumpToFragment(name)
+			proc.JumpToFragment(fstack.target(fn))
 		case RET:
 			proc.ReturnLastPoint()
 		case MVR:
@@ -336,12 +524,11 @@ func (proc *Process) run() {
 		case KVC:
 			fstack.Push(make(MapT))
 		case PRP:
-			vec := make([]Object, 2)
-			var vecref VecT = &vec
-			k, v := fstack.a(ins).(MapT)[fstack.b(ins).(string)]
-			vec[0] = k
-			vec[1] = boolNum(v)
-			fstack.Push(vecref)
+			if v, ok := fstack.a(ins).(MapT)[fstack.b(ins).(string)]; ok {
+				fstack.Push(v)
+			} else {
+				fstack.Push(Null{})
+			}
 		case ATT:
 			val, key, m := fstack.a(ins), fstack.b(ins).(string), fstack.c(ins).(MapT)
 			(m)[key] = val
@@ -384,10 +571,14 @@ func (proc *Process) run() {
 			fstack.Push(len(fstack.a(ins).(MapT)))
 		//STATE
 		case TE:
-			panic(fstack.a(ins))
+			v := fstack.a(ins)
+			if ex, rethrown := v.(Exception); rethrown {
+				panic(ex)
+			}
+			panic(Exception{fstack.b(ins).(string), v, nil, nil})
 		case RE:
-			proc.rescues = append(proc.rescues, RescuePoint{fstack.a(ins).(string),
-				fstack.index, proc.callstack.idx, fstack.b(ins).(int)})
+			proc.rescues = append(proc.rescues, RescuePoint{proc.symbol, proc.pc + fstack.a(ins).(int),
+				fstack.index, proc.callstack.idx, fstack.b(ins).(string), len(proc.deadlines)})
 		case DR:
 			proc.rescues = proc.rescues[0 : len(proc.rescues)-1]
 		//Interaction
@@ -395,6 +586,78 @@ func (proc *Process) run() {
 			proc.Invoke(fstack.a(ins).(string))
 		case IFD:
 			proc.DirectInvoke(fstack.a(ins).(EmbeddedFunction))
+		//PATTERNS
+		case EQV:
+			fstack.Push(equalObjects(fstack.a(ins), fstack.b(ins)))
+		case ISV:
+			fstack.Push(sizedVec(fstack.a(ins), fstack.b(ins).(int)))
+		//CLOSURES
+		case LCI:
+			fstack.Push((*proc.env.GetEnvironment(0).(VecT))[fstack.a(ins).(int)])
+		case MKC:
+			fstack.Push(Closure{fstack.a(ins).(string), fstack.b(ins).(VecT)})
+		//TASKS
+		case JON:
+			r := proc.join(asTask(fstack.a(ins)))
+			if fstack.b(ins).(int) != 0 {
+				fstack.Push(r)
+			}
+		case TDN:
+			fstack.Push(boolNum(asTask(fstack.a(ins)).finished()))
+		case TCN:
+			asTask(fstack.a(ins)).cancel()
+		//CHANNELS
+		case MCH:
+			fstack.Push(NewChannel(proc.machine, fstack.a(ins).(int)))
+		case SND:
+			proc.send(fstack.a(ins).(*Channel), fstack.b(ins))
+			proc.passTurn()
+		case RCV:
+			fstack.Push(proc.receive(fstack.a(ins).(*Channel)))
+			proc.passTurn()
+		case TRC:
+			fstack.Push(tryReceive(fstack.a(ins).(*Channel)))
+			proc.passTurn()
+		case CCH:
+			closeChannel(fstack.a(ins).(*Channel))
+			proc.passTurn()
+		case SEL:
+			v, i := proc.selectChannels(fstack, fstack.a(ins).([]bool), fstack.b(ins).(int) != 0)
+			fstack.Push(v)
+			fstack.Push(i)
+			proc.passTurn()
+		//MAILBOXES
+		case SLF:
+			fstack.Push(PID(proc))
+		case MSN:
+			asTask(fstack.a(ins)).mailbox.Post(fstack.b(ins))
+			proc.passTurn()
+		case MBP:
+			fstack.Push(proc.peekMessage(fstack.a(ins).(int)))
+		case MBT:
+			proc.mailbox.Take(fstack.a(ins).(int))
+			proc.passTurn()
+		case LNK:
+			other := asTask(fstack.a(ins))
+			other.watch(proc, true)
+			proc.watch(other, true)
+		case MON:
+			asTask(fstack.a(ins)).watch(proc, false)
+		//TIMEOUTS
+		case TMO:
+			proc.startDeadline(fstack.a(ins).(int))
+		case TMC:
+			proc.stopDeadlines(len(proc.deadlines) - 1)
+		//KINDS
+		case ISK:
+			fstack.Push(boolNum(isKind(fstack.a(ins), fstack.b(ins).(string))))
+		case ASK:
+			kind := fstack.a(ins).(string)
+			if v := fstack.Pop(); isKind(v, kind) {
+				fstack.Push(v)
+			} else {
+				panic(fmt.Errorf("Can not cast %s into %s", Show(v), kind))
+			}
 		}
 	}
 }
@@ -0,0 +1,180 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Called by the process before running each instruction, the process does not go on until it returns
+type Hook func(proc *Process)
+
+//Processes alive in the machine by id
+type registry struct {
+	lock      sync.Mutex
+	processes map[int]*Process
+	last      int
+	cancelled bool //The processes spawned from now on start cancelled
+}
+
+func (vm *VM) AddHook(h Hook) {
+	vm.hooks = append(vm.hooks, h)
+}
+
+func (vm *VM) register(proc *Process) {
+	vm.registry.lock.Lock()
+	defer vm.registry.lock.Unlock()
+	vm.registry.last++
+	proc.id = vm.registry.last
+	vm.registry.processes[proc.id] = proc
+	if vm.registry.cancelled {
+		proc.cancelled = 1
+	}
+}
+
+//Cancels every process, also the ones spawned meanwhile
+func (vm *VM) cancelAll() {
+	vm.registry.lock.Lock()
+	defer vm.registry.lock.Unlock()
+	vm.registry.cancelled = true
+	for _, p := range vm.registry.processes {
+		p.cancel()
+	}
+}
+
+//Called once the process ends, whether it returned, failed or was cancelled
+func (vm *VM) AddEndHook(h Hook) {
+	vm.endHooks = append(vm.endHooks, h)
+}
+
+func (vm *VM) unregister(proc *Process) {
+	vm.registry.lock.Lock()
+	delete(vm.registry.processes, proc.id)
+	vm.registry.lock.Unlock()
+	for _, hook := range vm.endHooks {
+		hook(proc)
+	}
+}
+
+//Processes still running, ordered by id
+func (vm *VM) Processes() []*Process {
+	vm.registry.lock.Lock()
+	defer vm.registry.lock.Unlock()
+	list := make([]*Process, 0, len(vm.registry.processes))
+	for _, p := range vm.registry.processes {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].id < list[j].id
+	})
+	return list
+}
+
+//Number given to the process when spawned, the first one is 1
+func (proc *Process) ID() int {
+	return proc.id
+}
+
+func (proc *Process) Depth() int {
+	return proc.callstack.idx
+}
+
+//Functions being run by the process, the innermost first, empty once it is done
+func (proc *Process) Trace() []Frame {
+	if proc.symbol == nil {
+		return []Frame{}
+	}
+	return proc.trace()
+}
+
+//Function and position of the instruction being run, as the first frame of the trace
+func (proc *Process) Location() Frame {
+	return frameOf(proc.symbol, proc.pc-1)
+}
+
+//Argument or local variable of a function by its name in the source
+type Binding struct {
+	Name  string
+	Value Object
+}
+
+//Arguments and local variables of the nth function of the trace
+func (proc *Process) Variables(frame int) (args []Binding, locals []Binding) {
+	if frame < 0 || frame > proc.callstack.idx || proc.symbol == nil {
+		panic(fmt.Errorf("No frame %d", frame))
+	}
+	e := &proc.callstack.elements[proc.callstack.idx-frame]
+	symbol, env, lcs := e.symbol, &e.env, &e.locals
+	if frame == 0 {
+		symbol, env, lcs = proc.symbol, proc.env, proc.locals
+	}
+	args, locals = make([]Binding, 0), make([]Binding, 0)
+	if info := symbol.Info; info != nil {
+		for i, name := range info.ArgNames {
+			if name[0] != '*' && i < len(env.args) {
+				args = append(args, Binding{name, env.args[i]})
+			}
+		}
+		for i, name := range info.Locals {
+			if name[0] != '*' && i < len(lcs.locals) {
+				locals = append(locals, Binding{name, lcs.locals[i]})
+			}
+		}
+		return
+	}
+	//No names for fragments without a function in the source
+	for i := 0; i < symbol.Args && i < len(env.args); i++ {
+		args = append(args, Binding{fmt.Sprintf("$%d", i), env.args[i]})
+	}
+	for i, v := range lcs.locals {
+		if v != nil {
+			locals = append(locals, Binding{fmt.Sprintf("$%d", i), v})
+		}
+	}
+	return
+}
+
+//Items of the function stack, the top first
+func (proc *Process) Stack() []Object {
+	fs := proc.functionstack
+	items := make([]Object, fs.index)
+	for i := range items {
+		items[i] = fs.data[fs.index-i-1]
+	}
+	return items
+}
+
+//Value as written in the source, vectors show their items
+func Describe(o Object) string {
+	switch v := o.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case VecT:
+		items := make([]string, len(*v))
+		for i, item := range *v {
+			items[i] = Describe(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case MapT:
+		items := make([]string, 0, len(v))
+		for k, item := range v {
+			items = append(items, k+": "+Describe(item))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	case Closure:
+		return "closure " + Demangle(v.Name)
+	case PID:
+		return fmt.Sprintf("process %d", (*Process)(v).id)
+	case *AtomicIntT:
+		return fmt.Sprintf("atomic %d", v.Load())
+	case int, float64, bool, Null, Exception:
+		return fmt.Sprintf("%v", o)
+	}
+	//Channels and locks are shared with other processes, their state is not read
+	return fmt.Sprintf("%T", o)
+}
@@ -1,5 +1,7 @@
 package runtime
 
+import "fmt"
+
 type ICode uint16
 
 const (
@@ -70,7 +72,7 @@ const (
 	//MAPS AND VECTORS
 
 	KVC = 39 //Creates a map
-	PRP = 40 //Gets value from map
+	PRP = 40 //Gets value from map, none if the key is missing
 	ATT = 41 //Attaches value to map
 	VEC = 42 //Creates a vector
 	ACC = 43 //Accesses position of vector
@@ -89,8 +91,8 @@ const (
 
 	//EXCEPTIONS
 
-	TE = 53 //Throw exception
-	RE = 54 //Rescue exception, sets an exception rescue fragment, and a exported local variable
+	TE = 53 //Throw exception, the value and the identity of its type, a rescued exception is thrown again as is
+	RE = 54 //Rescue exception, sets the offset of the handler and the type rescued
 	DR = 55 //Discard rescue, removes rescue
 
 	//Interaction
@@ -99,5 +101,152 @@ const (
 	SYS = 251 //Invokes a system call
 	IFD = 57  //Invocation for debugging, run directly methods, NOT SAFE!
 
+	//PATTERNS
+
+	EQV = 58 //Equal values, compares two primitive objects of any kind
+	ISV = 59 //Is sized vector, checks the object is a vector with the given size
+
+	//CLOSURES
+
+	LCI = 60 //Load captured item from the closure environment
+	MKC = 61 //Make closure, binds a symbol with an environment
+
+	//TASKS
+
+	JON = 62 //Join task, waits for the process and pushes its result if flagged
+	TDN = 63 //Task done, whether the process has finished
+	TCN = 64 //Task cancel, the process stops before its next instruction
+
+	//CHANNELS
+
+	MCH = 65 //Make channel with the given capacity
+	SND = 66 //Send value through channel, blocks until it is accepted
+	RCV = 67 //Receive from channel, blocks until a value arrives, none if the channel is closed
+	TRC = 68 //Try receive, none if there is no value ready
+	CCH = 69 //Close channel
+	SEL = 70 //Select, waits for the first case ready and pushes the received value and the index of the case
+
+	//MAILBOXES
+
+	SLF = 71 //Pushes the running process
+	MSN = 72 //Message send, posts the value in the mailbox of the process
+	MBP = 73 //Mailbox peek, waits for the message at the index of the own mailbox
+	MBT = 74 //Mailbox take, removes the message at the index
+	LNK = 75 //Link, both processes are told when the other crashes
+	MON = 76 //Monitor, the running process is told when the other ends
+
+	//TIMEOUTS
+
+	TMO = 77 //Timeout, starts a deadline of the given milliseconds for the code that follows
+	TMC = 78 //Timeout clear, stops the last deadline
+
+	//KINDS
+
+	ISK = 79 //Is kind, checks the object is a value of the type named, only Int, Dec, Str and Pid are told apart
+	ASK = 80 //Assert kind, throws unless the object on top of the stack is a value of the type named
+
 	LDOP = 256 //Last defined operation, just a mark
 )
+
+//Names of the instructions, as written in the listings and the traces
+var mnemonics = map[ICode]string{
+	NOP:  "NOP",
+	ADD:  "ADD",
+	SUB:  "SUB",
+	MUL:  "MUL",
+	DIV:  "DIV",
+	MOD:  "MOD",
+	ADDF: "ADDF",
+	SUBF: "SUBF",
+	MULF: "MULF",
+	DIVF: "DIVF",
+	ITD:  "ITD",
+	DTI:  "DTI",
+	CMPI: "CMPI",
+	CMPF: "CMPF",
+	NOT:  "NOT",
+	AND:  "AND",
+	OR:   "OR",
+	XOR:  "XOR",
+	NOTB: "NOTB",
+	SHL:  "SHL",
+	SHR:  "SHR",
+	LEI:  "LEI",
+	SEI:  "SEI",
+	LLI:  "LLI",
+	SLI:  "SLI",
+	PSH:  "PSH",
+	POP:  "POP",
+	CLR:  "CLR",
+	DUP:  "DUP",
+	SWT:  "SWT",
+	CLL:  "CLL",
+	CLX:  "CLX",
+	CLT:  "CLT",
+	JMP:  "JMP",
+	JMX:  "JMX",
+	RET:  "RET",
+	MVR:  "MVR",
+	MVT:  "MVT",
+	MVF:  "MVF",
+	KVC:  "KVC",
+	PRP:  "PRP",
+	ATT:  "ATT",
+	VEC:  "VEC",
+	ACC:  "ACC",
+	APP:  "APP",
+	SVI:  "SVI",
+	DMI:  "DMI",
+	PFV:  "PFV",
+	CSE:  "CSE",
+	EIS:  "EIS",
+	SOS:  "SOS",
+	SOV:  "SOV",
+	SOM:  "SOM",
+	TE:   "TE",
+	RE:   "RE",
+	DR:   "DR",
+	INV:  "INV",
+	SYS:  "SYS",
+	IFD:  "IFD",
+	EQV:  "EQV",
+	ISV:  "ISV",
+	LCI:  "LCI",
+	MKC:  "MKC",
+	JON:  "JON",
+	TDN:  "TDN",
+	TCN:  "TCN",
+	MCH:  "MCH",
+	SND:  "SND",
+	RCV:  "RCV",
+	TRC:  "TRC",
+	CCH:  "CCH",
+	SEL:  "SEL",
+	SLF:  "SLF",
+	MSN:  "MSN",
+	MBP:  "MBP",
+	MBT:  "MBT",
+	LNK:  "LNK",
+	MON:  "MON",
+	TMO:  "TMO",
+	TMC:  "TMC",
+	ISK:  "ISK",
+	ASK:  "ASK",
+}
+
+func (c ICode) String() string {
+	if name, ok := mnemonics[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("OP%d", int(c))
+}
+
+//Instruction named by the mnemonic, false if there is none
+func ParseICode(name string) (ICode, bool) {
+	for c, n := range mnemonics {
+		if n == name {
+			return c, true
+		}
+	}
+	return 0, false
+}
@@ -102,6 +102,15 @@ func (fs *FunctionStack) d(x Instruction) Object {
 	return o
 }
 
+//Closures push their environment, it becomes the first argument of the call
+func (fs *FunctionStack) target(fn Object) string {
+	if c, ok := fn.(Closure); ok {
+		fs.Push(c.Env)
+		return c.Name
+	}
+	return fn.(string)
+}
+
 type Environment struct {
 	args [8]Object
 }
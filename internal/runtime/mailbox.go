@@ -0,0 +1,94 @@
+package runtime
+
+import "sync"
+
+//Messages sent to a process, only the owner takes them out so indexes are stable while it scans
+type Mailbox struct {
+	lock     sync.Mutex
+	arrived  *sync.Cond
+	messages []Object
+	machine  *VM
+}
+
+func NewMailbox(vm *VM) *Mailbox {
+	m := &Mailbox{messages: make([]Object, 0), machine: vm}
+	m.arrived = sync.NewCond(&m.lock)
+	return m
+}
+
+func (m *Mailbox) Post(msg Object) {
+	m.lock.Lock()
+	m.messages = append(m.messages, msg)
+	m.lock.Unlock()
+	m.machine.stateChanged()
+	m.arrived.Broadcast()
+}
+
+//Waits until there is a message at the index of the own mailbox
+func (proc *Process) peekMessage(idx int) (msg Object) {
+	m := proc.mailbox
+	proc.wait(m.arrived, func() bool {
+		if len(m.messages) <= idx {
+			return false
+		}
+		msg = m.messages[idx]
+		return true
+	})
+	return
+}
+
+func (m *Mailbox) Take(idx int) {
+	m.lock.Lock()
+	m.messages = append(m.messages[:idx], m.messages[idx+1:]...)
+	m.lock.Unlock()
+}
+
+//Processes told when the process ends, links only hear of crashes
+type watchers struct {
+	lock     sync.Mutex
+	ended    bool
+	reason   Object
+	crashed  bool
+	links    []*Process
+	monitors []*Process
+}
+
+func exitMessage(from *Process, reason Object) Object {
+	return MakeVec("exit", PID(from), reason)
+}
+
+//Registers the watcher, if the process already ended it is told right away
+func (proc *Process) watch(by *Process, link bool) {
+	w := &proc.watchers
+	w.lock.Lock()
+	if !w.ended {
+		if link {
+			w.links = append(w.links, by)
+		} else {
+			w.monitors = append(w.monitors, by)
+		}
+		w.lock.Unlock()
+		return
+	}
+	w.lock.Unlock()
+	if w.crashed || !link {
+		by.mailbox.Post(exitMessage(proc, w.reason))
+	}
+}
+
+//The reason is the atom normal or the value of the uncaught exception
+func (proc *Process) notifyEnd(reason Object, crashed bool) {
+	w := &proc.watchers
+	w.lock.Lock()
+	w.ended, w.reason, w.crashed = true, reason, crashed
+	links, monitors := w.links, w.monitors
+	w.lock.Unlock()
+	for _, m := range monitors {
+		m.mailbox.Post(exitMessage(proc, reason))
+	}
+	if crashed {
+		for _, l := range links {
+			l.mailbox.Post(exitMessage(proc, reason))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package runtime
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+//Protocol buffers writer for the few types the pprof format needs
+type protobuf struct {
+	data []byte
+}
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.varint(uint64(field)<<3 | 0)
+	b.varint(x)
+}
+
+func (b *protobuf) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protobuf) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protobuf) bytes(field int, x []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(x)))
+	b.data = append(b.data, x...)
+}
+
+func (b *protobuf) string(field int, x string) {
+	b.bytes(field, []byte(x))
+}
+
+func (b *protobuf) message(field int, f func(m *protobuf)) {
+	m := &protobuf{}
+	f(m)
+	b.bytes(field, m.data)
+}
+
+func (b *protobuf) packed(field int, xs []uint64) {
+	m := &protobuf{}
+	for _, x := range xs {
+		m.varint(x)
+	}
+	b.bytes(field, m.data)
+}
+
+//Field numbers of profile.proto
+const (
+	pprofSampleType    = 1
+	pprofSample        = 2
+	pprofMapping       = 3
+	pprofLocation      = 4
+	pprofFunction      = 5
+	pprofStringTable   = 6
+	pprofTimeNanos     = 9
+	pprofDurationNanos = 10
+	pprofPeriodType    = 11
+	pprofPeriod        = 12
+)
+
+//Strings of the profile are written as indexes in a table, the empty one is the first
+type stringTable struct {
+	strings []string
+	index   map[string]int64
+}
+
+func (t *stringTable) id(s string) int64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	t.index[s] = int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	return int64(len(t.strings) - 1)
+}
+
+//Writes the gzipped pprof profile, with the instructions run and the wall time as sample types
+func (p *Profiler) Write(w io.Writer) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	duration := time.Since(p.start)
+	table := &stringTable{[]string{""}, map[string]int64{"": 0}}
+	b := &protobuf{}
+	valueType := func(field int, name, unit string) {
+		b.message(field, func(m *protobuf) {
+			m.int64(1, table.id(name))
+			m.int64(2, table.id(unit))
+		})
+	}
+	valueType(pprofSampleType, "instructions", "count")
+	valueType(pprofSampleType, "wall", "nanoseconds")
+	nodes := []*profileNode{p.root}
+	for len(nodes) > 0 {
+		node := nodes[len(nodes)-1]
+		nodes = nodes[:len(nodes)-1]
+		for _, c := range node.children {
+			nodes = append(nodes, c)
+		}
+		if len(node.values) == 0 {
+			continue
+		}
+		callers := make([]uint64, 0)
+		for n := node; n != p.root; n = n.parent {
+			callers = append(callers, n.location)
+		}
+		for id, values := range node.values {
+			ids := append([]uint64{id}, callers...)
+			b.message(pprofSample, func(m *protobuf) {
+				m.packed(1, ids)
+				m.packed(2, []uint64{uint64(values[0]), uint64(values[1])})
+			})
+		}
+	}
+	file := ""
+	if len(p.order) > 0 && p.order[0].symbol.Info != nil {
+		file = p.order[0].symbol.Info.File
+	}
+	b.message(pprofMapping, func(m *protobuf) {
+		m.uint64(1, 1)
+		m.uint64(3, uint64(len(p.order)+1))
+		m.int64(5, table.id(file))
+		m.bool(7, true)
+		m.bool(8, true)
+		m.bool(9, true)
+	})
+	functions := make(map[*Symbol]uint64)
+	for i, l := range p.order {
+		fn, ok := functions[l.symbol]
+		if !ok {
+			fn = uint64(len(functions) + 1)
+			functions[l.symbol] = fn
+		}
+		line := 0
+		if _, n, _, ok := l.symbol.Lines.Lookup(l.pc); ok {
+			line = n
+		} else if l.symbol.Info != nil {
+			line = l.symbol.Info.Line
+		}
+		b.message(pprofLocation, func(m *protobuf) {
+			m.uint64(1, uint64(i+1))
+			m.uint64(2, 1)
+			m.uint64(3, uint64(i+1))
+			m.message(4, func(n *protobuf) {
+				n.uint64(1, fn)
+				n.int64(2, int64(line))
+			})
+		})
+	}
+	for symbol, id := range functions {
+		name, file, start := Demangle(symbol.Name), "", 0
+		if info := symbol.Info; info != nil {
+			name, file, start = info.Function, info.File, info.Line
+		}
+		b.message(pprofFunction, func(m *protobuf) {
+			m.uint64(1, id)
+			m.int64(2, table.id(name))
+			m.int64(3, table.id(symbol.Name))
+			m.int64(4, table.id(file))
+			m.int64(5, int64(start))
+		})
+	}
+	b.int64(pprofTimeNanos, p.start.UnixNano())
+	b.int64(pprofDurationNanos, duration.Nanoseconds())
+	valueType(pprofPeriodType, "instructions", "count")
+	b.int64(pprofPeriod, 1)
+	for _, s := range table.strings {
+		b.string(pprofStringTable, s)
+	}
+	z := gzip.NewWriter(w)
+	if _, err := z.Write(b.data); err != nil {
+		return err
+	}
+	return z.Close()
+}
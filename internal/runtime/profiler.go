@@ -0,0 +1,136 @@
+package runtime
+
+import (
+	"sync"
+	"time"
+)
+
+//Counts the instructions run and the wall time spent on them by call stack, in order to write a pprof profile
+type Profiler struct {
+	lock      sync.Mutex
+	start     time.Time
+	locations map[profileLocation]uint64 //Ids by instruction, starting from 1
+	order     []profileLocation
+	root      *profileNode
+	procs     map[*Process]*profileProcess
+}
+
+type profileLocation struct {
+	symbol *Symbol
+	pc     int
+}
+
+//Call made from the location of the parent node, the root stands for no call at all
+type profileNode struct {
+	location uint64
+	parent   *profileNode
+	children map[uint64]*profileNode
+	values   map[uint64]*[2]int64 //Instructions run by the function called and their values
+}
+
+func (n *profileNode) child(location uint64) *profileNode {
+	if n.children == nil {
+		n.children = make(map[uint64]*profileNode)
+	}
+	c, ok := n.children[location]
+	if !ok {
+		c = &profileNode{location, n, nil, nil}
+		n.children[location] = c
+	}
+	return c
+}
+
+//Where the process was at its last instruction
+type profileProcess struct {
+	depth  int
+	calls  []*profileNode //Node of the function at each depth, along with the tail calls that led to it
+	bases  []*profileNode //Same nodes before the tail calls
+	last   *[2]int64      //Values of the last instruction, it gets the time until the next one
+	at     time.Time
+	jumped uint64 //Location of the tail call run last, if it was one
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{sync.Mutex{}, time.Now(), make(map[profileLocation]uint64), make([]profileLocation, 0),
+		&profileNode{}, make(map[*Process]*profileProcess)}
+}
+
+func (vm *VM) UseProfiler(p *Profiler) {
+	vm.AddHook(p.sample)
+	vm.AddEndHook(p.end)
+}
+
+func (p *Profiler) location(symbol *Symbol, pc int) uint64 {
+	l := profileLocation{symbol, pc}
+	id, ok := p.locations[l]
+	if !ok {
+		p.order = append(p.order, l)
+		id = uint64(len(p.order))
+		p.locations[l] = id
+	}
+	return id
+}
+
+func (p *Profiler) sample(proc *Process) {
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	st, ok := p.procs[proc]
+	if !ok {
+		st = &profileProcess{0, []*profileNode{p.root}, []*profileNode{p.root}, nil, now, 0}
+		p.procs[proc] = st
+	}
+	if st.last != nil {
+		st.last[1] += now.Sub(st.at).Nanoseconds()
+	}
+	depth := proc.callstack.idx
+	if depth < st.depth {
+		st.calls, st.bases = st.calls[:depth+1], st.bases[:depth+1]
+	}
+	for d := st.depth + 1; d <= depth; d++ {
+		e := &proc.callstack.elements[d-1]
+		n := st.calls[d-1].child(p.location(e.symbol, e.pc-1))
+		st.calls, st.bases = append(st.calls, n), append(st.bases, n)
+	}
+	st.depth = depth
+	if st.jumped != 0 {
+		st.calls[depth] = p.tailCall(st.calls[depth], st.bases[depth], st.jumped)
+	}
+	pc := proc.pc - 1
+	id := p.location(proc.symbol, pc)
+	node := st.calls[depth]
+	if node.values == nil {
+		node.values = make(map[uint64]*[2]int64)
+	}
+	values, ok := node.values[id]
+	if !ok {
+		values = &[2]int64{}
+		node.values[id] = values
+	}
+	values[0]++
+	st.last, st.at, st.jumped = values, now, 0
+	if code := proc.symbol.Source[pc].Code; code == JMP || code == JMX {
+		st.jumped = id
+	}
+}
+
+//The last instruction gets the time until the process ended, however it did
+func (p *Profiler) end(proc *Process) {
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if st, ok := p.procs[proc]; ok {
+		st.last[1] += now.Sub(st.at).Nanoseconds()
+		delete(p.procs, proc)
+	}
+}
+
+//Tail calls that loop back to a location already in the chain drop the calls made since then
+func (p *Profiler) tailCall(node, base *profileNode, location uint64) *profileNode {
+	for n := node; n != base; n = n.parent {
+		if n.location == location {
+			return n
+		}
+	}
+	return node.child(location)
+}
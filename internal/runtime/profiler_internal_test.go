@@ -0,0 +1,36 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+)
+
+//Processes that crash or are cancelled never run a RET at the bottom of their stack
+func TestProfilerForgetsEndedProcesses(t *testing.T) {
+	vm := NewVM()
+	vm.LoadSymbols(map[string]Symbol{
+		"returns": {"returns", Fragment{MKInstruction(PSH, 1), MKInstruction(RET)}, 0, nil, LineTable{}},
+		"crashes": {"crashes", Fragment{MKInstruction(PSH, 0), MKInstruction(PSH, 1), MKInstruction(DIV)}, 0, nil, LineTable{}},
+		"spins":   {"spins", Fragment{MKInstruction(NOP), MKInstruction(MVR, -2)}, 0, nil, LineTable{}},
+	})
+	profiler := NewProfiler()
+	vm.UseProfiler(profiler)
+	for _, name := range []string{"returns", "crashes", "spins"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		proc, err := vm.InitSpawn(ctx, name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "spins" {
+			cancel()
+		}
+		vm.Wait(ctx, proc)
+		<-proc.done
+		cancel()
+	}
+	profiler.lock.Lock()
+	defer profiler.lock.Unlock()
+	if len(profiler.procs) != 0 {
+		t.Fatalf("Expecting every process to be forgotten, %d left", len(profiler.procs))
+	}
+}
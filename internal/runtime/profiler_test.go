@@ -0,0 +1,121 @@
+package runtime_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+type protoField struct {
+	number int
+	value  uint64
+	data   []byte
+}
+
+//Reads a varint from the start of data, which is left after it
+func readVarint(t *testing.T, data *[]byte) uint64 {
+	var x uint64
+	for shift := uint(0); ; shift += 7 {
+		if len(*data) == 0 {
+			t.Fatal("Truncated message")
+		}
+		b := (*data)[0]
+		*data = (*data)[1:]
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x
+		}
+	}
+}
+
+//Fields of a protocol buffers message, only varints and bytes are expected
+func readMessage(t *testing.T, data []byte) []protoField {
+	fields := make([]protoField, 0)
+	for len(data) > 0 {
+		key := readVarint(t, &data)
+		f := protoField{int(key >> 3), 0, nil}
+		switch key & 7 {
+		case 0:
+			f.value = readVarint(t, &data)
+		case 2:
+			n := readVarint(t, &data)
+			f.data, data = data[:n], data[n:]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func readPacked(t *testing.T, data []byte) []uint64 {
+	values := make([]uint64, 0)
+	for len(data) > 0 {
+		values = append(values, readVarint(t, &data))
+	}
+	return values
+}
+
+func TestProfiler(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn hot: n Int do
+		    var i = 0
+		    var t = 0
+		    while i < n do
+		        t = t + i
+		        i = i + 1
+		    return t
+
+		fn main: args Vec|Str do
+		    print: hot(1000)
+	`
+	profiler := runtime.NewProfiler()
+	if _, err := bsttest.Run(t, src, func(vm *runtime.VM) {
+		vm.UseProfiler(profiler)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := profiler.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	z, err := gzip.NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	var instructions uint64
+	samples := 0
+	for _, f := range readMessage(t, data) {
+		switch f.number {
+		case 2:
+			samples++
+			for _, s := range readMessage(t, f.data) {
+				if s.number == 2 {
+					instructions += readPacked(t, s.data)[0]
+				}
+			}
+		case 6:
+			names[string(f.data)] = true
+		}
+	}
+	for _, s := range []string{"instructions", "wall", "nanoseconds", "hot", "main"} {
+		if !names[s] {
+			t.Fatalf("Expecting %q in the string table", s)
+		}
+	}
+	//The loop alone runs more than ten instructions by iteration
+	if samples == 0 || instructions < 10000 {
+		t.Fatalf("Expecting the instructions run, got %d in %d samples", instructions, samples)
+	}
+}
@@ -1,15 +1,95 @@
 package runtime
 
+import (
+	"fmt"
+	"strings"
+)
+
 type EmbeddedFunction struct {
 	Name     string
 	ArgCount int
 	Function func(args []Object) Object
 	Returns  bool
+	Blocking func(proc *Process, args []Object) Object //Used instead of Function when it needs the process, like when it may wait
 }
 type Object interface{}
 type MapT map[string]Object
 type VecT *[]Object
 
+//Value of an empty optional
+type Null struct{}
+
+func (Null) String() string {
+	return "none"
+}
+
+//Value as printed by the programs, processes are shown by their number
+func Show(o Object) string {
+	switch v := o.(type) {
+	case PID:
+		return fmt.Sprintf("<process %d>", (*Process)(v).id)
+	case VecT:
+		items := make([]string, len(*v))
+		for i, item := range *v {
+			items[i] = Show(item)
+		}
+		return "&[" + strings.Join(items, " ") + "]"
+	}
+	return fmt.Sprint(o)
+}
+
+//Name of the type of the errors raised by the machine itself
+const RuntimeErrorType = "RuntimeError"
+
+//Name of the type of the errors raised when a deadline passes
+const TimeoutErrorType = "TimeoutError"
+
+//Kind of the rescue points that receive the exception itself, in order to throw it again
+const AnyException = "*"
+
+//Thrown value along with the identity of its type, rescues are matched against it
+type Exception struct {
+	Type  string
+	Value Object
+	Trace []Frame    //Functions being run where it was thrown, the innermost first
+	Cause *Exception //Failure of the child process it was thrown again from
+}
+
+//Go panics, such as failed assertions or overflows, become a RuntimeError{message}
+func AsException(e interface{}) Exception {
+	if ex, ok := e.(Exception); ok {
+		return ex
+	}
+	return Exception{RuntimeErrorType, MakeVec(fmt.Sprintf("%v", e)), nil, nil}
+}
+
+//Message received by the rescues without type, other values than strings and errors of the machine go along with their type
+func (e Exception) String() string {
+	if _, ok := e.Value.(string); ok || e.machineError() {
+		return e.shown()
+	}
+	return e.Type + " " + e.shown()
+}
+
+//Thrown value as printed by the programs, the errors of the machine by their message
+func (e Exception) shown() string {
+	if e.machineError() {
+		return Show((*e.Value.(VecT))[0])
+	}
+	return Show(e.Value)
+}
+
+func (e Exception) machineError() bool {
+	_, ok := e.Value.(VecT)
+	return ok && (e.Type == RuntimeErrorType || e.Type == TimeoutErrorType)
+}
+
+//Function value carrying the environment captured when it was created
+type Closure struct {
+	Name string
+	Env  VecT
+}
+
 func MakeVec(items ...Object) VecT {
 	var vec []Object = items
 	return VecT(&vec)
@@ -51,6 +131,8 @@ type Symbol struct {
 	Name   string   //fragment name
 	Source Fragment //fragment
 	Args   int
+	Info   *SymbolInfo //Nil for fragments with no function in the source
+	Lines  LineTable
 }
 
 func (s *Symbol) Append(i Instruction) {
@@ -0,0 +1,181 @@
+package runtime
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+//Runs the processes one at a time, passing the turn after a quantum of instructions or when blocked
+type Scheduler struct {
+	changes uint64 //Counts the changes a blocked process may be waiting for, such as a value sent, first to be aligned for atomics
+	quantum int
+	random  *rand.Rand //Picks the next process, the seed fixes the interleaving
+	live    []*Process
+	pending int32         //Timers still to fire
+	alarms  chan struct{} //Told when a timer fires
+	failure atomic.Value  //Error that stopped every process, such as a deadlock
+}
+
+//Reported by VM.Wait once every process is blocked and no timer may wake them
+var ErrDeadlock = errors.New("Deadlock, every process is waiting")
+
+func (s *Scheduler) changed() {
+	atomic.AddUint64(&s.changes, 1)
+}
+
+//Without a scheduler the changes are not counted, the processes wait on the conditions alone
+func (vm *VM) stateChanged() {
+	if vm.scheduler != nil {
+		vm.scheduler.changed()
+	}
+}
+
+//Every process spawned after the call is run by the scheduler
+func (vm *VM) UseScheduler(quantum int, seed int64) {
+	if quantum < 1 {
+		quantum = 1
+	}
+	vm.scheduler = &Scheduler{0, quantum, rand.New(rand.NewSource(seed)), make([]*Process, 0), 0, make(chan struct{}, 1), atomic.Value{}}
+}
+
+//The first process starts with the turn, the others wait for it
+func (s *Scheduler) enter(proc *Process) {
+	s.live = append(s.live, proc)
+	if len(s.live) == 1 {
+		proc.turn <- struct{}{}
+	}
+}
+
+func (s *Scheduler) leave(proc *Process) {
+	for i, p := range s.live {
+		if p == proc {
+			s.live = append(s.live[:i], s.live[i+1:]...)
+			break
+		}
+	}
+	s.changed()
+	if next := s.pick(); next != nil {
+		next.turn <- struct{}{}
+	}
+}
+
+func (s *Scheduler) ring() {
+	select {
+	case s.alarms <- struct{}{}:
+	default:
+	}
+}
+
+//Random process among the ones not blocked since the last change, nil if there is none
+func (s *Scheduler) pick() *Process {
+	ready := make([]*Process, 0, len(s.live))
+	now := atomic.LoadUint64(&s.changes) + 1
+	for _, p := range s.live {
+		if p.stalledAt != now {
+			ready = append(ready, p)
+		}
+	}
+	if len(ready) == 0 {
+		return nil
+	}
+	return ready[s.random.Intn(len(ready))]
+}
+
+//Counts the instruction, the turn is passed once the quantum is spent
+func (proc *Process) tick() {
+	s := proc.machine.scheduler
+	proc.steps++
+	if proc.steps >= s.quantum {
+		proc.yield(false)
+	}
+}
+
+//Channel and mailbox operations pass the turn even when they did not wait, so the others may act on what they did
+func (proc *Process) passTurn() {
+	if proc.machine.scheduler != nil {
+		proc.yield(false)
+	}
+}
+
+//Marks the process as blocked until something changes, it is called before checking whether it may go on
+func (proc *Process) stall() {
+	proc.stalledAt = atomic.LoadUint64(&proc.machine.scheduler.changes) + 1
+}
+
+//Passes the turn and waits to get it back, a blocked process must have stalled before
+func (proc *Process) yield(blocked bool) {
+	s := proc.machine.scheduler
+	proc.steps = 0
+	if !blocked {
+		proc.stalledAt = 0
+	}
+	next := s.pick()
+	for next == nil {
+		//Every process is waiting, only a timer may wake them
+		select {
+		case <-s.alarms:
+		default:
+			if atomic.LoadInt32(&s.pending) == 0 {
+				s.deadlock()
+			} else {
+				<-s.alarms
+			}
+		}
+		s.changed()
+		next = s.pick()
+	}
+	if next == proc {
+		return
+	}
+	next.turn <- struct{}{}
+	<-proc.turn
+}
+
+//Waits until try succeeds, it is called with the lock of the condition held
+func (proc *Process) wait(cond *sync.Cond, try func() bool) {
+	if proc.machine.scheduler == nil {
+		proc.waitingOn(cond)
+		defer proc.waitingOn(nil)
+		cond.L.Lock()
+		defer cond.L.Unlock()
+		for {
+			proc.checkSignals()
+			if try() {
+				return
+			}
+			cond.Wait()
+		}
+	}
+	for {
+		proc.stall()
+		if attempt(cond.L, try) {
+			proc.stalledAt = 0
+			return
+		}
+		proc.yield(true)
+		proc.checkSignals()
+	}
+}
+
+//Every process is cancelled, so they end and VM.Wait reports the deadlock instead of their errors
+func (s *Scheduler) deadlock() {
+	s.failure.Store(ErrDeadlock)
+	for _, p := range s.live {
+		atomic.StoreInt32(&p.cancelled, 1)
+	}
+}
+
+//The condition is broadcast to wake the process when it gets a signal
+func (proc *Process) waitingOn(cond *sync.Cond) {
+	proc.waitlock.Lock()
+	proc.waiting = cond
+	proc.waitlock.Unlock()
+}
+
+func attempt(lock sync.Locker, try func() bool) bool {
+	lock.Lock()
+	defer lock.Unlock()
+	return try()
+}
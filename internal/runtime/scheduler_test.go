@@ -0,0 +1,130 @@
+package runtime_test
+
+import (
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+const pipeline = `
+	import "../std"
+
+	fn pass: a Chan|Int, b Chan|Int, n Int do
+	    var i = 0
+	    while i < n do
+	        if val x = receive(a) do
+	            send: b, x + 1
+	        i = i + 1
+
+	fn main: args Vec|Str do
+	    val a = [Chan|Int]
+	    val b = [Chan|Int]
+	    val c = [Chan|Int]
+	    pass: a, b, 20 spawn
+	    pass: b, c, 20 spawn
+	    var i = 0
+	    var total = 0
+	    while i < 20 do
+	        send: a, i
+	        if val x = receive(c) do
+	            total = total + x
+	        i = i + 1
+	    print: total
+`
+
+//Work done between turns, like a value put in a channel, must wake the blocked processes
+func TestSchedulerNoFalseDeadlock(t *testing.T) {
+	for quantum := 1; quantum <= 4; quantum++ {
+		for seed := int64(0); seed < 21; seed++ {
+			out, err := bsttest.Run(t, pipeline, bsttest.Scheduled(quantum, seed))
+			if err != nil || out != "230\n" {
+				t.Fatalf("Quantum %d seed %d: got %q, %v", quantum, seed, out, err)
+			}
+		}
+	}
+}
+
+func TestSchedulerDeadlockIsReportedByWait(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn main: args Vec|Str do
+		    rescue e do
+		        print: "rescued ", e
+		    val a = [Chan|Int]
+		    receive: a
+		    print: "never"
+	`
+	out, err := bsttest.Run(t, src, bsttest.Scheduled(1, 0))
+	if err != runtime.ErrDeadlock {
+		t.Fatalf("Expecting deadlock, got %v", err)
+	}
+	if out != "" {
+		t.Fatalf("The deadlock must not be rescued, got %q", out)
+	}
+}
+
+func TestSchedulerKeepsGOMAXPROCS(t *testing.T) {
+	before := goruntime.GOMAXPROCS(0)
+	if _, err := bsttest.Run(t, pipeline, bsttest.Scheduled(3, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if after := goruntime.GOMAXPROCS(0); after != before {
+		t.Fatalf("GOMAXPROCS changed from %d to %d", before, after)
+	}
+}
+
+func TestSchedulerBlockedProcessesAfterMainEnds(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn stuck: ch Chan|Int do
+		    receive: ch
+		    print: "never"
+
+		fn main: args Vec|Str do
+		    val ch = [Chan|Int]
+		    stuck: ch spawn
+		    print: "done"
+	`
+	for seed := int64(0); seed < 5; seed++ {
+		out, err := bsttest.Run(t, src, bsttest.Scheduled(1, seed))
+		if err != nil || !strings.HasPrefix(out, "done") {
+			t.Fatalf("Seed %d: got %q, %v", seed, out, err)
+		}
+	}
+}
+
+//Even with a long quantum, processes using channels take turns after each operation
+func TestSchedulerPassesTurnAfterChannelOperations(t *testing.T) {
+	src := `
+		import "../std"
+
+		fn poll: c Chan|Int, name Str do
+		    var i = 0
+		    while i < 3 do
+		        try_receive: c
+		        print: name, i
+		        i = i + 1
+
+		fn main: args Vec|Str do
+		    val c = [Chan|Int]
+		    val t = poll: c, "b" spawn
+		    poll: c, "a"
+		    join: t
+	`
+	grouped := map[string]bool{"a0\na1\na2\nb0\nb1\nb2\n": true, "b0\nb1\nb2\na0\na1\na2\n": true}
+	for seed := int64(0); seed < 10; seed++ {
+		out, err := bsttest.Run(t, src, bsttest.Scheduled(1000, seed))
+		if err != nil {
+			t.Fatalf("Seed %d: %v", seed, err)
+		}
+		if !grouped[out] {
+			return
+		}
+	}
+	t.Fatal("The processes never took turns between their operations")
+}
@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+//Tasks spawned by a process, each one belongs to the call that spawned it
+type family struct {
+	lock     sync.Mutex
+	children []child
+	failed   *Process //First child ended by an uncaught exception
+}
+
+type child struct {
+	task  *Process
+	depth int //Size of the call stack of the parent when it was spawned
+}
+
+//Every process waits for its tasks when the call that spawned them returns
+func (vm *VM) UseStructured() {
+	vm.structured = true
+}
+
+func (proc *Process) adopt(task *Process) {
+	f := &proc.family
+	f.lock.Lock()
+	f.children = append(f.children, child{task, proc.callstack.idx})
+	f.lock.Unlock()
+}
+
+//The siblings are cancelled at once, the parent throws the failure again once it waits or returns
+func (proc *Process) childFailed(task *Process) {
+	f := &proc.family
+	f.lock.Lock()
+	first := f.failed == nil
+	if first {
+		f.failed = task
+	}
+	f.lock.Unlock()
+	if first {
+		proc.cancelChildren(task)
+		atomic.StoreInt32(&proc.interrupted, 1)
+		proc.wake()
+	}
+}
+
+func (proc *Process) cancelChildren(except *Process) {
+	f := &proc.family
+	f.lock.Lock()
+	children := f.children
+	f.lock.Unlock()
+	for _, c := range children {
+		if c.task != except {
+			c.task.cancel()
+		}
+	}
+}
+
+//Waits for the tasks spawned at the depth of the call stack or deeper
+func (proc *Process) awaitChildren(depth int) {
+	f := &proc.family
+	f.lock.Lock()
+	i := len(f.children)
+	for i > 0 && f.children[i-1].depth >= depth {
+		i--
+	}
+	pending := f.children[i:]
+	f.lock.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+	for _, c := range pending {
+		proc.await(c.task)
+	}
+	f.lock.Lock()
+	f.children = f.children[:i]
+	f.lock.Unlock()
+	proc.checkSignals()
+}
+
+//Cancels the tasks spawned by the calls an exception unwound, deeper than the depth of the call stack
+func (proc *Process) dropChildren(depth int) {
+	f := &proc.family
+	f.lock.Lock()
+	i := len(f.children)
+	for i > 0 && f.children[i-1].depth > depth {
+		i--
+	}
+	dropped := f.children[i:]
+	f.children = f.children[:i]
+	f.lock.Unlock()
+	for _, c := range dropped {
+		c.task.cancel()
+	}
+}
+
+//The failure of the task was thrown by joining it, it is not thrown again
+func (proc *Process) observed(task *Process) {
+	f := &proc.family
+	f.lock.Lock()
+	if f.failed == task {
+		f.failed = nil
+		atomic.StoreInt32(&proc.interrupted, 0)
+	}
+	f.lock.Unlock()
+}
+
+//Throws the pending cancellation, timeout or failure of a child, checked whenever the process waits
+func (proc *Process) checkSignals() {
+	if atomic.LoadInt32(&proc.cancelled) != 0 {
+		panic(errCancelled)
+	}
+	if atomic.LoadInt32(&proc.expired) != 0 {
+		proc.checkTimeout()
+	}
+	if atomic.LoadInt32(&proc.interrupted) != 0 {
+		f := &proc.family
+		f.lock.Lock()
+		task := f.failed
+		f.failed = nil
+		atomic.StoreInt32(&proc.interrupted, 0)
+		f.lock.Unlock()
+		panic(rethrown(task))
+	}
+}
+
+func (proc *Process) cancel() {
+	atomic.StoreInt32(&proc.cancelled, 1)
+	proc.wake()
+}
+
+func (proc *Process) cancelWhenDone() {
+	select {
+	case <-proc.ctx.Done():
+		proc.cancel()
+	case <-proc.done:
+	}
+}
+
+//Wakes the process if it is waiting, so it sees its signals
+func (proc *Process) wake() {
+	proc.machine.stateChanged()
+	proc.waitlock.Lock()
+	cond := proc.waiting
+	proc.waitlock.Unlock()
+	if cond != nil {
+		cond.L.Lock()
+		cond.Broadcast()
+		cond.L.Unlock()
+	}
+}
@@ -0,0 +1,124 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+func structured(vm *runtime.VM) {
+	vm.UseStructured()
+}
+
+//Returning from a call waits for the tasks it spawned, a failed one cancels its siblings and is thrown in the parent
+func TestStructured(t *testing.T) {
+	out, err := bsttest.Run(t, `
+		import "../std"
+
+		struct Boom: code Int
+
+		fn slow: n Int do
+		    sleep: n
+		    print: "slow done ", n
+
+		fn crash: n Int do
+		    sleep: 5
+		    throw {n}Boom
+
+		fn forever do
+		    while true do
+		        sleep: 1
+
+		fn group do
+		    slow: 20 spawn
+		    slow: 40 spawn
+		    print: "group returns"
+
+		fn failing do
+		    forever: spawn
+		    crash: 7 spawn
+		    sleep: 1000
+		    print: "never"
+
+		fn main: args Vec|Str do
+		    group:
+		    print: "after group"
+		    rescue e Boom do
+		        print: "child failed with ", e.code
+		    failing:
+	`, structured)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := bsttest.Source(`
+		group returns
+		slow done 20
+		slow done 40
+		after group
+		child failed with 7
+	`)
+	if out != want {
+		t.Fatalf("Got:\n%s\nExpecting:\n%s", out, want)
+	}
+}
+
+//An uncaught failure of a child ends the parent with the trace of the child as its cause
+func TestStructuredUncaughtFailure(t *testing.T) {
+	_, err := bsttest.Run(t, `
+		import "../std"
+
+		struct Boom: code Int
+
+		fn crash: n Int do
+		    throw {n}Boom
+
+		fn main: args Vec|Str do
+		    crash: 3 spawn
+		    sleep: 1000
+	`, structured)
+	failure, ok := err.(*runtime.ProcessError)
+	if !ok {
+		t.Fatalf("Expecting a process error, got %v", err)
+	}
+	if cause := failure.Exception.Cause; cause == nil || len(cause.Trace) == 0 || cause.Trace[0].Function != "crash" {
+		t.Fatalf("Expecting the failure of crash as the cause, got %v", err)
+	}
+}
+
+//The tasks spawned by the calls an exception unwinds are cancelled instead of awaited
+func TestStructuredUnwindCancelsChildren(t *testing.T) {
+	out, err := bsttest.Run(t, `
+		import "../std"
+
+		fn forever do
+		    while true do
+		        sleep: 1
+
+		fn waiter do
+		    val t = forever: spawn
+		    join: t
+
+		fn main: args Vec|Str do
+		    do
+		        rescue e TimeoutError do
+		            print: "timeout: ", e.message
+		        with_timeout: 50, fn waiter: {}
+		    val w = waiter: spawn
+		    sleep: 10
+		    cancel: w
+		    rescue e RuntimeError do
+		        print: "cancelled: ", e.message
+		    join: w
+	`, structured)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := bsttest.Source(`
+		timeout: Timed out after 50 ms
+		cancelled: Task cancelled
+	`)
+	if out != want {
+		t.Fatalf("Got:\n%s\nExpecting:\n%s", out, want)
+	}
+}
@@ -0,0 +1,104 @@
+package runtime
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+//Mutual exclusion between processes, waiting for it lets the scheduler pass the turn
+type MutexT struct {
+	lock   sync.Mutex
+	freed  *sync.Cond
+	locked bool
+}
+
+func NewMutex() *MutexT {
+	m := &MutexT{}
+	m.freed = sync.NewCond(&m.lock)
+	return m
+}
+
+func (m *MutexT) Lock(proc *Process) {
+	proc.wait(m.freed, func() bool {
+		if m.locked {
+			return false
+		}
+		m.locked = true
+		return true
+	})
+}
+
+func (m *MutexT) TryLock() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.locked {
+		return false
+	}
+	m.locked = true
+	return true
+}
+
+func (m *MutexT) Unlock(proc *Process) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if !m.locked {
+		panic(errors.New("Unlocking a mutex that is not locked"))
+	}
+	m.locked = false
+	proc.machine.stateChanged()
+	m.freed.Broadcast()
+}
+
+type AtomicIntT struct {
+	value int64
+}
+
+func (a *AtomicIntT) Load() int {
+	return int(atomic.LoadInt64(&a.value))
+}
+
+func (a *AtomicIntT) Store(v int) {
+	atomic.StoreInt64(&a.value, int64(v))
+}
+
+//Returns the new value
+func (a *AtomicIntT) Add(delta int) int {
+	return int(atomic.AddInt64(&a.value, int64(delta)))
+}
+
+func (a *AtomicIntT) CompareAndSwap(old, new int) bool {
+	return atomic.CompareAndSwapInt64(&a.value, int64(old), int64(new))
+}
+
+//Counter of pending jobs, waiting ends once it gets back to zero
+type WaitGroupT struct {
+	lock  sync.Mutex
+	zero  *sync.Cond
+	count int
+}
+
+func NewWaitGroup() *WaitGroupT {
+	w := &WaitGroupT{}
+	w.zero = sync.NewCond(&w.lock)
+	return w
+}
+
+func (w *WaitGroupT) Add(proc *Process, delta int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.count+delta < 0 {
+		panic(errors.New("Negative wait group counter"))
+	}
+	w.count += delta
+	if w.count == 0 {
+		proc.machine.stateChanged()
+		w.zero.Broadcast()
+	}
+}
+
+func (w *WaitGroupT) Wait(proc *Process) {
+	proc.wait(w.zero, func() bool {
+		return w.count == 0
+	})
+}
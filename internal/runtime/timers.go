@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//Timer the scheduler waits for instead of reporting a deadlock
+type alarm struct {
+	timer *time.Timer
+	sched *Scheduler
+}
+
+func (vm *VM) setAlarm(d time.Duration, f func()) *alarm {
+	a := &alarm{nil, vm.scheduler}
+	if a.sched != nil {
+		atomic.AddInt32(&a.sched.pending, 1)
+	}
+	a.timer = time.AfterFunc(d, func() {
+		f()
+		if a.sched != nil {
+			a.sched.ring()
+			atomic.AddInt32(&a.sched.pending, -1)
+		}
+	})
+	return a
+}
+
+func (a *alarm) stop() {
+	if a.timer.Stop() && a.sched != nil {
+		atomic.AddInt32(&a.sched.pending, -1)
+	}
+}
+
+func (proc *Process) Sleep(d time.Duration) {
+	var lock sync.Mutex
+	over := sync.NewCond(&lock)
+	expired := false
+	a := proc.machine.setAlarm(d, func() {
+		lock.Lock()
+		expired = true
+		proc.machine.stateChanged()
+		over.Broadcast()
+		lock.Unlock()
+	})
+	defer a.stop()
+	proc.wait(over, func() bool {
+		return expired
+	})
+}
+
+type deadline struct {
+	alarm *alarm
+	fired int32
+	ms    int
+}
+
+//Once the deadline passes a TimeoutError is raised in the process
+func (proc *Process) startDeadline(ms int) {
+	d := &deadline{nil, 0, ms}
+	d.alarm = proc.machine.setAlarm(time.Duration(ms)*time.Millisecond, func() {
+		atomic.StoreInt32(&d.fired, 1)
+		atomic.StoreInt32(&proc.expired, 1)
+		proc.wake()
+	})
+	proc.deadlines = append(proc.deadlines, d)
+}
+
+//Stops the deadlines started after the first n
+func (proc *Process) stopDeadlines(n int) {
+	for len(proc.deadlines) > n {
+		proc.deadlines[len(proc.deadlines)-1].alarm.stop()
+		proc.deadlines = proc.deadlines[:len(proc.deadlines)-1]
+	}
+}
+
+//The outermost deadline passed is raised, the ones already stopped are ignored
+func (proc *Process) checkTimeout() {
+	atomic.StoreInt32(&proc.expired, 0)
+	for i, d := range proc.deadlines {
+		if atomic.LoadInt32(&d.fired) != 0 {
+			proc.stopDeadlines(i)
+			panic(Exception{TimeoutErrorType, MakeVec(fmt.Sprintf("Timed out after %d ms", d.ms)), nil, nil})
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Writes a line for every instruction run, run the processes in turns to get the same trace on every run
+type Tracer struct {
+	lock   sync.Mutex
+	out    *bufio.Writer
+	depth  int            //Items of the function stack written, the top first
+	prefix string         //Only the symbols whose compiled name starts with it
+	codes  map[ICode]bool //Only these instructions, every one when empty
+	json   bool           //JSON Lines instead of text
+	err    error          //First error writing, the tracer stops once there is one
+}
+
+//Entry of the trace when written as JSON
+type traceEntry struct {
+	Process  int           `json:"process"`
+	Symbol   string        `json:"symbol"`
+	PC       int           `json:"pc"`
+	Op       string        `json:"op"`
+	Operands []interface{} `json:"operands"`
+	Stack    []interface{} `json:"stack"`
+}
+
+func NewTracer(out io.Writer, depth int, prefix string, codes []ICode, asJSON bool) *Tracer {
+	t := &Tracer{sync.Mutex{}, bufio.NewWriter(out), depth, prefix, make(map[ICode]bool), asJSON, nil}
+	for _, c := range codes {
+		t.codes[c] = true
+	}
+	return t
+}
+
+func (vm *VM) UseTracer(t *Tracer) {
+	vm.AddHook(t.trace)
+}
+
+func (t *Tracer) trace(proc *Process) {
+	pc := proc.pc - 1
+	ins := proc.symbol.Source[pc]
+	if !strings.HasPrefix(proc.symbol.Name, t.prefix) || len(t.codes) > 0 && !t.codes[ins.Code] {
+		return
+	}
+	stack := proc.functionstack
+	top := make([]Object, 0, t.depth)
+	for i := stack.index - 1; i >= 0 && len(top) < t.depth; i-- {
+		top = append(top, stack.data[i])
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err != nil {
+		return
+	}
+	if t.json {
+		t.err = t.writeJSON(proc.id, proc.symbol.Name, pc, ins, top)
+	} else {
+		t.err = t.writeText(proc.id, proc.symbol.Name, pc, ins, top)
+	}
+}
+
+//Process symbol pc mnemonic operands | stack, the operands taken from the stack are written as _
+func (t *Tracer) writeText(id int, symbol string, pc int, ins Instruction, top []Object) error {
+	line := make([]string, 0, 8)
+	line = append(line, strconv.Itoa(id), symbol, strconv.Itoa(pc), ins.Code.String())
+	for _, o := range ins.Inspect() {
+		if o == nil {
+			line = append(line, "_")
+		} else {
+			line = append(line, Describe(o))
+		}
+	}
+	line = append(line, "|")
+	for _, o := range top {
+		line = append(line, Describe(o))
+	}
+	_, err := t.out.WriteString(strings.Join(line, " ") + "\n")
+	return err
+}
+
+func (t *Tracer) writeJSON(id int, symbol string, pc int, ins Instruction, top []Object) error {
+	operands := make([]interface{}, 0, 4)
+	for _, o := range ins.Inspect() {
+		operands = append(operands, jsonValue(o))
+	}
+	stack := make([]interface{}, len(top))
+	for i, o := range top {
+		stack[i] = jsonValue(o)
+	}
+	b, err := json.Marshal(traceEntry{id, symbol, pc, ins.Code.String(), operands, stack})
+	if err != nil {
+		return err
+	}
+	_, err = t.out.Write(append(b, '\n'))
+	return err
+}
+
+//Primitives are kept as they are, the other values are described
+func jsonValue(o Object) interface{} {
+	switch v := o.(type) {
+	case nil, int, bool, string:
+		return v
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return v
+		}
+	}
+	return Describe(o)
+}
+
+//Writes the lines still buffered, returns the first error found while tracing
+func (t *Tracer) Flush() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.err != nil {
+		return t.err
+	}
+	return t.out.Flush()
+}
@@ -0,0 +1,80 @@
+package runtime_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+const traced = `
+	import "../std"
+
+	fn twice: n Int do
+	    return n * 2
+
+	fn main: args Vec|Str do
+	    print: twice(10 - 3)
+`
+
+func TestTracerText(t *testing.T) {
+	var b bytes.Buffer
+	tracer := runtime.NewTracer(&b, 2, "main/", []runtime.ICode{runtime.SUB}, false)
+	out, err := bsttest.Run(t, traced, func(vm *runtime.VM) {
+		vm.UseTracer(tracer)
+	})
+	if err != nil || out != "14\n" {
+		t.Fatalf("Got %q, %v", out, err)
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expecting only the subtraction of main, got:\n%s", b.String())
+	}
+	fields := strings.Fields(lines[0])
+	if fields[0] != "1" || !strings.HasPrefix(fields[1], "main/") || fields[3] != "SUB" ||
+		strings.Join(fields[4:], " ") != "| 10 3" {
+		t.Fatalf("Unexpected line %q", lines[0])
+	}
+}
+
+func TestTracerJSON(t *testing.T) {
+	var b bytes.Buffer
+	tracer := runtime.NewTracer(&b, 1, "twice/", []runtime.ICode{runtime.MUL, runtime.RET}, true)
+	if _, err := bsttest.Run(t, traced, func(vm *runtime.VM) {
+		vm.UseTracer(tracer)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	ops := make([]string, 0)
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var entry struct {
+			Process int
+			Symbol  string
+			Op      string
+			Stack   []interface{}
+		}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Process != 1 || !strings.HasPrefix(entry.Symbol, "twice/") {
+			t.Fatalf("Unexpected entry %+v", entry)
+		}
+		if entry.Op == "RET" && (len(entry.Stack) != 1 || entry.Stack[0] != float64(14)) {
+			t.Fatalf("Expecting the result on the stack when returning, got %v", entry.Stack)
+		}
+		ops = append(ops, entry.Op)
+	}
+	if strings.Join(ops, " ") != "MUL RET" {
+		t.Fatalf("Expecting MUL RET, got %v", ops)
+	}
+}
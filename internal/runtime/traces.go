@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//Source level description of a symbol, in order to report traces
+type SymbolInfo struct {
+	Function string   //Name in the source
+	Args     []string //Types of the arguments
+	File     string
+	Line     int      //Line of the declaration
+	ArgNames []string //Names of the arguments by position, the hidden ones start with *
+	Locals   []string //Names of the local variables by slot
+}
+
+//Function being run when the trace was taken
+type Frame struct {
+	Function string
+	Args     []string
+	File     string
+	Line     int
+	Column   int
+	Symbol   string //Compiled name
+	PC       int
+}
+
+func (f Frame) String() string {
+	call := fmt.Sprintf("%s(%s)", f.Function, strings.Join(f.Args, ", "))
+	if f.File == "" {
+		return call
+	}
+	if f.Column == 0 {
+		return fmt.Sprintf("%s at %s:%d", call, f.File, f.Line)
+	}
+	return fmt.Sprintf("%s at %s:%d:%d", call, f.File, f.Line, f.Column)
+}
+
+//Name in the source of the compiled name, as generated for functions: name/args$mode@module
+func Demangle(cname string) string {
+	name := cname
+	if i := strings.LastIndex(name, "$"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, "/"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func frameOf(symbol *Symbol, pc int) Frame {
+	if pc < 0 {
+		pc = 0
+	}
+	f := Frame{Demangle(symbol.Name), nil, "", 0, 0, symbol.Name, pc}
+	if info := symbol.Info; info != nil {
+		f.Function, f.Args, f.File, f.Line = info.Function, info.Args, info.File, info.Line
+	}
+	if file, line, column, ok := symbol.Lines.Lookup(pc); ok {
+		f.File, f.Line, f.Column = file, line, column
+	}
+	return f
+}
+
+//Functions being run by the process, the innermost first
+func (proc *Process) trace() []Frame {
+	frames := make([]Frame, 0, proc.callstack.idx+1)
+	frames = append(frames, frameOf(proc.symbol, proc.pc-1))
+	for i := proc.callstack.idx - 1; i >= 0; i-- {
+		e := &proc.callstack.elements[i]
+		frames = append(frames, frameOf(e.symbol, e.pc-1))
+	}
+	return frames
+}
+
+//Trace of the exception and of the child processes it comes from
+func (e Exception) Lines() []string {
+	lines := make([]string, 0, len(e.Trace))
+	for _, f := range e.Trace {
+		lines = append(lines, "at "+f.String())
+	}
+	if e.Cause != nil {
+		lines = append(lines, "raised by child process")
+		lines = append(lines, e.Cause.Lines()...)
+	}
+	return lines
+}
+
+//Uncaught exception that ended a process, returned by VM.Wait
+type ProcessError struct {
+	Exception Exception
+}
+
+func (e *ProcessError) Error() string {
+	return fmt.Sprintf("Runtime error: %s: %s\n\t%s", e.Exception.Type, e.Exception.shown(), strings.Join(e.Exception.Lines(), "\n\t"))
+}
+
+//Trace of the last exception rescued by the process, empty if there is none
+func (proc *Process) RescuedTrace() VecT {
+	lines := make([]Object, 0)
+	if proc.handling != nil {
+		for _, l := range proc.handling.Lines() {
+			lines = append(lines, l)
+		}
+	}
+	return &lines
+}
+
+//Source position of the instructions of a symbol, each entry holds from its pc until the next one
+type LineTable struct {
+	Files   []string
+	Entries []LineEntry
+}
+
+type LineEntry struct {
+	PC     int
+	File   int //Index in Files
+	Line   int
+	Column int
+}
+
+//Records the position of the instruction at pc, the ones after it keep it until the next mark
+func (t *LineTable) Mark(pc int, file string, line, column int) {
+	f := -1
+	for i, name := range t.Files {
+		if name == file {
+			f = i
+			break
+		}
+	}
+	if f < 0 {
+		f = len(t.Files)
+		t.Files = append(t.Files, file)
+	}
+	entry := LineEntry{pc, f, line, column}
+	if n := len(t.Entries); n > 0 {
+		last := t.Entries[n-1]
+		if last.File == f && last.Line == line && last.Column == column {
+			return
+		}
+		if last.PC == pc {
+			t.Entries[n-1] = entry
+			return
+		}
+	}
+	t.Entries = append(t.Entries, entry)
+}
+
+//Position of the instruction at pc, false if it is not known
+func (t *LineTable) Lookup(pc int) (file string, line, column int, ok bool) {
+	i := sort.Search(len(t.Entries), func(i int) bool {
+		return t.Entries[i].PC > pc
+	})
+	if i == 0 {
+		return "", 0, 0, false
+	}
+	e := t.Entries[i-1]
+	return t.Files[e.File], e.Line, e.Column, true
+}
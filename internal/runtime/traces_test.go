@@ -0,0 +1,95 @@
+package runtime_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/besten/internal/bsttest"
+	"github.com/besten/internal/runtime"
+)
+
+const failing = `
+	import "../std"
+
+	struct Boom: code Int
+
+	fn inner: n Int, s Str do
+	    if n > 0 do
+	        throw {n}Boom
+	    return n
+
+	fn main: args Vec|Str do
+	    print: inner(2, "x")
+`
+
+func uncaught(t *testing.T) *runtime.ProcessError {
+	t.Helper()
+	_, err := bsttest.Run(t, failing, nil)
+	failure, ok := err.(*runtime.ProcessError)
+	if !ok {
+		t.Fatalf("Expecting a process error, got %v", err)
+	}
+	return failure
+}
+
+//The trace holds the functions being run with their source names and argument types, the innermost first
+func TestTraceOfUncaughtException(t *testing.T) {
+	ex := uncaught(t).Exception
+	if !strings.HasSuffix(ex.Type, "/main.bst.Boom") {
+		t.Fatalf("Expecting the Boom of main.bst, got %s", ex.Type)
+	}
+	if len(ex.Trace) != 2 {
+		t.Fatalf("Expecting two frames, got %v", ex.Trace)
+	}
+	for i, want := range []struct {
+		function string
+		args     []string
+	}{{"inner", []string{"Int", "Str"}}, {"main", []string{"Vec|Str"}}} {
+		f := ex.Trace[i]
+		if f.Function != want.function || !reflect.DeepEqual(f.Args, want.args) || filepath.Base(f.File) != "main.bst" {
+			t.Fatalf("Frame %d: got %v", i, f)
+		}
+	}
+}
+
+//The message tells the type of the uncaught value along with the value as the programs print it
+func TestUncaughtMessage(t *testing.T) {
+	failure := uncaught(t)
+	want := "Runtime error: " + failure.Exception.Type + ": &[2]\n\tat inner"
+	if !strings.HasSuffix(failure.Exception.Type, "/main.bst.Boom") || !strings.HasPrefix(failure.Error(), want) {
+		t.Fatalf("Expecting the message to begin with %q, got %q", want, failure.Error())
+	}
+}
+
+//Frames point at the line and column of the instruction being run
+func TestTraceLines(t *testing.T) {
+	ex := uncaught(t).Exception
+	for i, want := range [][2]int{{7, 9}, {11, 5}} {
+		if f := ex.Trace[i]; f.Line != want[0] || f.Column != want[1] {
+			t.Fatalf("Frame %d: expecting %d:%d, got %v", i, want[0], want[1], f)
+		}
+	}
+}
+
+func TestLineTable(t *testing.T) {
+	table := runtime.LineTable{}
+	table.Mark(0, "a.bst", 1, 1)
+	table.Mark(3, "a.bst", 2, 5)
+	table.Mark(4, "a.bst", 2, 5)
+	table.Mark(6, "b.bst", 9, 2)
+	if len(table.Entries) != 3 || len(table.Files) != 2 {
+		t.Fatalf("Expecting three entries in two files, got %v", table)
+	}
+	for pc, want := range map[int]string{0: "a.bst:1:1", 2: "a.bst:1:1", 3: "a.bst:2:5", 5: "a.bst:2:5", 6: "b.bst:9:2", 40: "b.bst:9:2"} {
+		file, line, column, ok := table.Lookup(pc)
+		if got := fmt.Sprintf("%s:%d:%d", file, line, column); !ok || got != want {
+			t.Fatalf("Pc %d: expecting %s, got %s", pc, want, got)
+		}
+	}
+	if _, _, _, ok := (&runtime.LineTable{}).Lookup(0); ok {
+		t.Fatal("An empty table knows no position")
+	}
+}